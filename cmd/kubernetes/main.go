@@ -28,6 +28,7 @@ func buildRootCommand(in io.Reader) *cobra.Command {
 
 	cmd.AddCommand(buildVersionCommand(m))
 	cmd.AddCommand(buildRunCommand(m))
+	cmd.AddCommand(buildSecretsCommand(m))
 
 	return cmd
 }
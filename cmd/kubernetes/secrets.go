@@ -0,0 +1,101 @@
+package main
+
+import (
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes"
+	"github.com/spf13/cobra"
+)
+
+func buildSecretsCommand(p *kubernetes.Plugin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage secrets stored by the kubernetes.secrets plugin",
+	}
+
+	cmd.AddCommand(buildSecretsDeleteCommand(p))
+	cmd.AddCommand(buildSecretsRewrapCommand(p))
+	cmd.AddCommand(buildSecretsNameCommand(p))
+
+	return cmd
+}
+
+func buildSecretsDeleteCommand(p *kubernetes.Plugin) *cobra.Command {
+	opts := kubernetes.DeleteSecretOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "delete KEY",
+		Short: "Delete a secret created by the kubernetes.secrets plugin",
+		Long: `Delete a secret created by the kubernetes.secrets plugin.
+
+The plugin configuration may be passed with --config, or piped to the command on stdin, as JSON, for example
+{"namespace": "porter"}. Secrets that were not created by the plugin are not deleted, including secrets created by
+versions of the plugin that did not label them, which must be deleted with kubectl. Deleting a secret that does not
+exist is not an error.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Validate(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.DeleteSecret(cmd.Context(), opts)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&opts.Namespace, "namespace", "n", "",
+		"Namespace of the secret. Defaults to the namespace in the plugin configuration.")
+	f.StringVar(&opts.ConfigFile, "config", "",
+		"Path to a JSON file with the plugin configuration. Defaults to reading the configuration from stdin.")
+
+	return cmd
+}
+
+func buildSecretsRewrapCommand(p *kubernetes.Plugin) *cobra.Command {
+	opts := kubernetes.RewrapSecretsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "rewrap [KEY...]",
+		Short: "Rewrap encrypted secrets with the current encryption key",
+		Long: `Rewrap the data keys of secrets encrypted by the kubernetes.secrets plugin with the current encryption key.
+
+Run this after adding a new key to the start of the keyring, or rotating the key in the KMS, so that the previous key
+may be removed. Only the annotations of the secrets are updated, the encrypted values are not changed.
+The plugin configuration, including the encryption settings, must be passed with --config, or piped to the command
+on stdin, as JSON.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Validate(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.RewrapSecrets(cmd.Context(), opts)
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&opts.All, "all", false,
+		"Rewrap every encrypted secret created by the plugin in the namespace.")
+	f.StringVarP(&opts.Namespace, "namespace", "n", "",
+		"Namespace of the secrets. Defaults to the namespace in the plugin configuration.")
+	f.StringVar(&opts.ConfigFile, "config", "",
+		"Path to a JSON file with the plugin configuration. Defaults to reading the configuration from stdin.")
+
+	return cmd
+}
+
+func buildSecretsNameCommand(p *kubernetes.Plugin) *cobra.Command {
+	opts := kubernetes.SecretNameOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "name KEY",
+		Short: "Print the name of the Kubernetes secret for a key",
+		Long: `Print the name of the Kubernetes secret that holds the value of a key.
+
+Keys that are valid Kubernetes names are used as is. Other keys are converted to a valid name, with a hash of the
+key appended so that different keys never share a secret. The original key is recorded in the secrets.porter.sh/key
+annotation of the secret.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Validate(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.PrintSecretName(opts)
+		},
+	}
+
+	return cmd
+}
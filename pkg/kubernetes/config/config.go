@@ -4,4 +4,154 @@ type Config struct {
 
 	// Namespace is the kubernetes namespace in the cluster that will contain the bundle secrets, if running in Kubernetes this value can be excluded and the service account namespace of the pod runing the process will be used.
 	Namespace string `json:"namespace"`
+
+	// ConnectionConfig selects the cluster that the plugin connects to, defaults to the in-cluster service account or the kubeconfig.
+	ConnectionConfig `mapstructure:",squash"`
+
+	// Clusters are named cluster profiles, that references select with a CLUSTER: prefix, such as workload-a:db-creds.
+	Clusters map[string]ClusterConfig `json:"clusters,omitempty"`
+
+	// DataKey is the key in a Kubernetes secret that holds the secret value, defaults to "value".
+	DataKey string `json:"dataKey,omitempty"`
+
+	// FallbackDataKeys are the keys that are tried, in order, when a secret does not have DataKey, defaults to ["credential"].
+	FallbackDataKeys []string `json:"fallbackDataKeys,omitempty"`
+
+	// ConflictPolicy is what happens when a secret being created already exists: fail (the default), idempotent or replace.
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// Immutable determines if the secrets created by the plugin are immutable, defaults to true.
+	Immutable *bool `json:"immutable,omitempty"`
+
+	// Labels are added to the secrets created by the plugin.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the secrets created by the plugin.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Compression is the algorithm used to compress the values written by the plugin: none (the default), gzip or zstd.
+	Compression string `json:"compression,omitempty"`
+
+	// AllowedHostSources are the sources resolved from the host running the plugin that may be used: env, path and command.
+	// Defaults to all of them, or none of them when the plugin is running in a Kubernetes pod.
+	AllowedHostSources []string `json:"allowedHostSources,omitempty"`
+
+	// TokenAudiences are the audiences of the tokens requested by the serviceaccount-token source, defaults to the API server's audiences.
+	TokenAudiences []string `json:"tokenAudiences,omitempty"`
+
+	// TokenExpiration is the lifetime of the tokens requested by the serviceaccount-token source, such as 30m, defaults to 1h.
+	TokenExpiration string `json:"tokenExpiration,omitempty"`
+
+	// TokenServiceAccounts are the service accounts in other namespaces, NAMESPACE/NAME, that tokens may be requested for.
+	// Patterns such as ci/* are allowed. Tokens may always be requested for service accounts in the plugin's namespace.
+	TokenServiceAccounts []string `json:"tokenServiceAccounts,omitempty"`
+
+	// ExposeLabel is a label or annotation, KEY[=VALUE], that secrets must have to be resolved, such as porter.sh/expose=true.
+	// Every secret may be resolved when it is not set.
+	ExposeLabel string `json:"exposeLabel,omitempty"`
+
+	// RequireGrants determines if secrets and configmaps in other namespaces may only be used when a grant ConfigMap in their namespace allows it, defaults to false.
+	RequireGrants bool `json:"requireGrants,omitempty"`
+
+	// Prefetch determines if the secrets in the namespace are listed once and resolved from memory, defaults to false.
+	Prefetch bool `json:"prefetch,omitempty"`
+
+	// PrefetchSelector is a label selector that limits the secrets that are prefetched, such as porter.sh/expose=true.
+	PrefetchSelector string `json:"prefetchSelector,omitempty"`
+
+	// Retry configures the timeout of each API call, and the retries of calls that fail with a retryable error.
+	Retry RetryConfig `json:"retry,omitempty"`
+
+	// Policy restricts the namespaces that the plugin may read from and write to, every namespace is allowed by default.
+	Policy PolicyConfig `json:"policy,omitempty"`
+
+	// Encryption configures the key used to encrypt the values written by the plugin, values are not encrypted by default.
+	Encryption EncryptionConfig `json:"encryption,omitempty"`
+}
+
+// EncryptionConfig selects the key-encryption key that wraps the data keys of encrypted values, only one of the settings may be used.
+type EncryptionConfig struct {
+	// KeyFile is the path to a keyring file, with one ID=BASE64KEY entry per line. The first key is used to encrypt new values.
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// KeySecret is a reference to a Kubernetes secret holding a keyring, [NAMESPACE/]NAME[#KEY], the keyring is read from the "keyring" key by default.
+	KeySecret string `json:"keySecret,omitempty"`
+
+	// KMSEndpoint is the gRPC endpoint of a Kubernetes KMS v2 plugin, for example unix:///var/run/kmsplugin/socket.sock.
+	KMSEndpoint string `json:"kmsEndpoint,omitempty"`
+
+	// Previous is the key provider that values were encrypted with before the provider was changed, it is only used to read them.
+	Previous *EncryptionConfig `json:"previous,omitempty"`
+}
+
+// PolicyConfig restricts the namespaces that the plugin may use, with patterns such as tenant-a-*.
+type PolicyConfig struct {
+	// AllowedNamespaces are the namespaces that may be used, defaults to every namespace that is not denied.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// DeniedNamespaces are the namespaces that may never be used, even when they are allowed.
+	DeniedNamespaces []string `json:"deniedNamespaces,omitempty"`
+}
+
+// ConnectionConfig selects the cluster that the plugin connects to, and the credentials that it uses.
+type ConnectionConfig struct {
+	// Kubeconfig is the path to the kubeconfig file used to connect to the cluster, defaults to KUBECONFIG or ~/.kube/config.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// KubeconfigData is the content of the kubeconfig used to connect to the cluster, instead of a kubeconfig file.
+	KubeconfigData string `json:"kubeconfigData,omitempty"`
+
+	// Context is the kubeconfig context used to connect to the cluster, defaults to the current context.
+	Context string `json:"context,omitempty"`
+
+	// Server is the URL of the API server, which overrides the server in the kubeconfig.
+	Server string `json:"server,omitempty"`
+
+	// Token is the bearer token used to authenticate to the API server.
+	Token string `json:"token,omitempty"`
+
+	// TokenFile is the path to a file holding the bearer token used to authenticate to the API server.
+	TokenFile string `json:"tokenFile,omitempty"`
+
+	// CertificateAuthority is the path to the CA bundle of the API server.
+	CertificateAuthority string `json:"certificateAuthority,omitempty"`
+
+	// CertificateAuthorityData is the PEM encoded CA bundle of the API server.
+	CertificateAuthorityData string `json:"certificateAuthorityData,omitempty"`
+
+	// InCluster forces the use of the service account of the pod running the plugin, instead of a kubeconfig.
+	InCluster bool `json:"inCluster,omitempty"`
+
+	// Impersonate is the user that the plugin's requests are authorized as, such as system:serviceaccount:NAMESPACE:NAME.
+	Impersonate string `json:"impersonate,omitempty"`
+
+	// ImpersonateGroups are the groups of the impersonated user.
+	ImpersonateGroups []string `json:"impersonateGroups,omitempty"`
+
+	// QPS is the number of requests per second that the plugin may make to the API server, defaults to 5.
+	QPS float32 `json:"qps,omitempty"`
+
+	// Burst is the number of requests that the plugin may make at once above QPS, defaults to 10.
+	Burst int `json:"burst,omitempty"`
+}
+
+// ClusterConfig is a named cluster profile, with its own connection settings and default namespace.
+type ClusterConfig struct {
+	// Namespace is the namespace used by references that don't specify one, defaults to the namespace of the kubeconfig context.
+	Namespace string `json:"namespace,omitempty"`
+
+	// ConnectionConfig selects the cluster of the profile.
+	ConnectionConfig `mapstructure:",squash"`
+}
+
+// RetryConfig configures the timeout and the retries of API calls.
+type RetryConfig struct {
+	// Timeout limits each attempt of an API call, such as 10s, defaults to 30s.
+	Timeout string `json:"timeout,omitempty"`
+
+	// MaxAttempts is the number of attempts of an API call, including the first, defaults to 5. Set to 1 to disable retries.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// InitialBackoff is the delay before the first retry, which is doubled for each later retry, defaults to 250ms.
+	InitialBackoff string `json:"initialBackoff,omitempty"`
 }
@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"context"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"github.com/pkg/errors"
+)
+
+type DeleteSecretOptions struct {
+	Key string
+
+	// Namespace overrides the namespace from the plugin configuration.
+	Namespace string
+
+	// ConfigFile is a JSON file with the plugin configuration. Defaults to stdin.
+	ConfigFile string
+}
+
+func (o *DeleteSecretOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("The positional argument KEY was not specified")
+	}
+	if len(args) > 1 {
+		return errors.New("Multiple positional arguments were specified but only one, KEY is expected")
+	}
+
+	o.Key = args[0]
+	return nil
+}
+
+// DeleteSecret removes a secret created by the kubernetes.secrets plugin.
+// The plugin configuration is read from the config file, or from stdin, in
+// the same format that Porter passes it to the plugin.
+func (p *Plugin) DeleteSecret(ctx context.Context, opts DeleteSecretOptions) error {
+	if err := p.LoadConfigFile(opts.ConfigFile); err != nil {
+		return err
+	}
+	if opts.Namespace != "" {
+		p.Namespace = opts.Namespace
+	}
+
+	cfg, err := secrets.NewPluginConfig(p.Context, p.Config)
+	if err != nil {
+		return err
+	}
+	store := secrets.NewStore(p.Context, cfg)
+	return store.Delete(ctx, secrets.SecretSourceType, opts.Key)
+}
@@ -1,27 +1,258 @@
 package helper
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func GetClientSet(namespace string) (*kubernetes.Clientset, *string, error) {
+const (
+	// serviceAccountNamespaceFile holds the namespace of the pod's service account.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	// serviceAccountUsernamePrefix is the prefix of the usernames of service
+	// accounts, system:serviceaccount:NAMESPACE:NAME.
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+)
+
+// ConnectionConfig selects the cluster that the plugins connect to, and the
+// credentials that they use. When it is empty, the in-cluster configuration
+// is used in a pod, and otherwise the kubeconfig from KUBECONFIG or
+// ~/.kube/config with its current context.
+type ConnectionConfig struct {
+	// Kubeconfig is the path to a kubeconfig file.
+	Kubeconfig string `mapstructure:"kubeconfig"`
+
+	// KubeconfigData is the content of a kubeconfig file.
+	KubeconfigData string `mapstructure:"kubeconfigData"`
+
+	// Context is the kubeconfig context to use, instead of the current context.
+	Context string `mapstructure:"context"`
+
+	// Server is the URL of the API server, which overrides the kubeconfig.
+	Server string `mapstructure:"server"`
+
+	// Token is a bearer token used to authenticate to the API server.
+	Token string `mapstructure:"token"`
+
+	// TokenFile is the path to a file holding a bearer token, which is read
+	// again when it changes.
+	TokenFile string `mapstructure:"tokenFile"`
+
+	// CertificateAuthority is the path to the CA bundle of the API server.
+	CertificateAuthority string `mapstructure:"certificateAuthority"`
+
+	// CertificateAuthorityData is the PEM encoded CA bundle of the API server.
+	CertificateAuthorityData string `mapstructure:"certificateAuthorityData"`
+
+	// InCluster forces the use of the pod's service account, and fails
+	// instead of falling back to a kubeconfig outside a cluster.
+	InCluster bool `mapstructure:"inCluster"`
+
+	// Impersonate is the user that every request is authorized as, such as
+	// jane or system:serviceaccount:NAMESPACE:NAME.
+	Impersonate string `mapstructure:"impersonate"`
+
+	// ImpersonateGroups are the groups of the impersonated user.
+	ImpersonateGroups []string `mapstructure:"impersonateGroups"`
+
+	// QPS is the number of requests per second that the client may make to
+	// the API server. Defaults to the client-go default of 5.
+	QPS float32 `mapstructure:"qps"`
+
+	// Burst is the number of requests that the client may make at once,
+	// above QPS. Defaults to the client-go default of 10.
+	Burst int `mapstructure:"burst"`
+}
+
+// Validate checks that the settings do not conflict.
+func (c ConnectionConfig) Validate() error {
+	if c.Kubeconfig != "" && c.KubeconfigData != "" {
+		return fmt.Errorf("invalid connection settings: only one of kubeconfig and kubeconfigData may be set")
+	}
+	if c.Token != "" && c.TokenFile != "" {
+		return fmt.Errorf("invalid connection settings: only one of token and tokenFile may be set")
+	}
+	if c.CertificateAuthority != "" && c.CertificateAuthorityData != "" {
+		return fmt.Errorf("invalid connection settings: only one of certificateAuthority and certificateAuthorityData may be set")
+	}
+	if c.InCluster && (c.Kubeconfig != "" || c.KubeconfigData != "" || c.Context != "" || c.Server != "" ||
+		c.Token != "" || c.TokenFile != "" || c.CertificateAuthority != "" || c.CertificateAuthorityData != "") {
+		return fmt.Errorf("invalid connection settings: inCluster can't be combined with other connection settings")
+	}
+	if c.QPS < 0 || c.Burst < 0 {
+		return fmt.Errorf("invalid connection settings: qps and burst can't be negative")
+	}
+	return validateImpersonation(c.Impersonate, c.ImpersonateGroups)
+}
+
+func validateImpersonation(user string, groups []string) error {
+	if user == "" {
+		if len(groups) > 0 {
+			return fmt.Errorf("invalid connection settings: impersonateGroups requires impersonate")
+		}
+		return nil
+	}
+	if serviceAccount, ok := strings.CutPrefix(user, serviceAccountUsernamePrefix); ok {
+		namespace, name, ok := strings.Cut(serviceAccount, ":")
+		if !ok || strings.Contains(name, ":") {
+			return fmt.Errorf("invalid impersonate %q: expected %sNAMESPACE:NAME", user, serviceAccountUsernamePrefix)
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid impersonate %q: invalid namespace %q: %s", user, namespace, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("invalid impersonate %q: invalid service account name %q: %s", user, name, strings.Join(errs, ", "))
+		}
+	}
+	for _, group := range groups {
+		if group == "" {
+			return fmt.Errorf("invalid connection settings: impersonateGroups can't contain an empty group")
+		}
+	}
+	return nil
+}
+
+// source describes where the connection settings are loaded from, for errors.
+func (c ConnectionConfig) source() string {
+	var source string
+	switch {
+	case c.InCluster:
+		return "the in-cluster service account"
+	case c.KubeconfigData != "":
+		source = "the kubeconfigData setting"
+	case c.Kubeconfig != "":
+		source = fmt.Sprintf("the kubeconfig file %s", c.Kubeconfig)
+	case os.Getenv(clientcmd.RecommendedConfigPathEnvVar) != "":
+		source = fmt.Sprintf("the kubeconfig from %s=%s", clientcmd.RecommendedConfigPathEnvVar, os.Getenv(clientcmd.RecommendedConfigPathEnvVar))
+	default:
+		source = fmt.Sprintf("the in-cluster service account or the kubeconfig file %s", clientcmd.RecommendedHomeFile)
+	}
+
+	var overrides []string
+	if c.Context != "" {
+		overrides = append(overrides, "context "+c.Context)
+	}
+	if c.Server != "" {
+		overrides = append(overrides, "server "+c.Server)
+	}
+	if len(overrides) > 0 {
+		source += " with " + strings.Join(overrides, " and ")
+	}
+	return source
+}
+
+// identity describes the impersonated user, for errors.
+func (c ConnectionConfig) identity() string {
+	if c.Impersonate == "" {
+		return ""
+	}
+	return " as " + c.Impersonate
+}
+
+// apply applies the settings of the client to the rest config: the
+// impersonation settings, so that every request is authorized as the
+// impersonated user, and the rate limit.
+func (c ConnectionConfig) apply(restConfig *rest.Config) {
+	if c.Impersonate != "" {
+		restConfig.Impersonate = rest.ImpersonationConfig{UserName: c.Impersonate, Groups: c.ImpersonateGroups}
+	}
+	if c.QPS > 0 {
+		restConfig.QPS = c.QPS
+	}
+	if c.Burst > 0 {
+		restConfig.Burst = c.Burst
+	}
+}
+
+// clientConfig returns the kubeconfig loader for the settings, with the
+// explicit settings applied as overrides.
+func (c ConnectionConfig) clientConfig() (clientcmd.ClientConfig, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: c.Context}
+	overrides.ClusterInfo.Server = c.Server
+	overrides.ClusterInfo.CertificateAuthority = c.CertificateAuthority
+	overrides.ClusterInfo.CertificateAuthorityData = []byte(c.CertificateAuthorityData)
+	overrides.AuthInfo.Token = c.Token
+	overrides.AuthInfo.TokenFile = c.TokenFile
+
+	if c.KubeconfigData != "" {
+		kubeConfig, err := clientcmd.Load([]byte(c.KubeconfigData))
+		if err != nil {
+			return nil, err
+		}
+		return clientcmd.NewNonInteractiveClientConfig(*kubeConfig, c.Context, overrides, nil), nil
+	}
+
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-	restConfig, err := kubeConfig.ClientConfig()
+	loadingRules.ExplicitPath = c.Kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides), nil
+}
+
+// InCluster determines if the plugin is running in a Kubernetes pod with a
+// service account, such as the Porter Operator's agent.
+func InCluster() bool {
+	_, err := rest.InClusterConfig()
+	return err == nil
+}
+
+func GetClientSet(namespace string, conn ConnectionConfig) (*kubernetes.Clientset, *string, error) {
+	restConfig, ns, err := GetRestConfig(namespace, conn)
 	if err != nil {
 		return nil, nil, err
 	}
 	clientSet, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("could not create a client for %s%s: %w", conn.source(), conn.identity(), err)
+	}
+	return clientSet, ns, nil
+}
+
+// GetRestConfig loads the configuration used to connect to the cluster, and
+// the namespace from the connection settings when namespace is empty.
+func GetRestConfig(namespace string, conn ConnectionConfig) (*rest.Config, *string, error) {
+	if conn.InCluster {
+		restConfig, ns, err := getInClusterConfig(namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		conn.apply(restConfig)
+		return restConfig, ns, nil
+	}
+
+	kubeConfig, err := conn.clientConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load the cluster connection from %s: %w", conn.source(), err)
+	}
+	restConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load the cluster connection from %s: %w", conn.source(), err)
 	}
 	if namespace == "" {
 		namespace, _, err = kubeConfig.Namespace()
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, fmt.Errorf("could not determine the namespace from %s: %w", conn.source(), err)
+		}
+	}
+	conn.apply(restConfig)
+	return restConfig, &namespace, nil
+}
+
+func getInClusterConfig(namespace string) (*rest.Config, *string, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load the cluster connection from the in-cluster service account: %w", err)
+	}
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not determine the namespace from the in-cluster service account: %w", err)
 		}
+		namespace = strings.TrimSpace(string(data))
 	}
-	return clientSet, &namespace, nil
+	return restConfig, &namespace, nil
 }
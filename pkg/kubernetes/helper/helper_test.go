@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+users:
+- name: admin
+  user:
+    token: admin-token
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: admin
+    namespace: dev-ns
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+    namespace: prod-ns
+current-context: dev
+`
+
+func TestGetRestConfig(t *testing.T) {
+	t.Run("kubeconfig file and context", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config")
+		require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+		restConfig, namespace, err := GetRestConfig("", ConnectionConfig{Kubeconfig: path, Context: "prod"})
+		require.NoError(t, err)
+		require.Equal(t, "https://prod.example.com", restConfig.Host)
+		require.Equal(t, "admin-token", restConfig.BearerToken)
+		require.Equal(t, "prod-ns", *namespace)
+	})
+
+	t.Run("inline kubeconfig with overrides", func(t *testing.T) {
+		restConfig, namespace, err := GetRestConfig("porter", ConnectionConfig{
+			KubeconfigData:           testKubeconfig,
+			Server:                   "https://override.example.com",
+			Token:                    "override-token",
+			CertificateAuthorityData: "test-ca",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "https://override.example.com", restConfig.Host)
+		require.Equal(t, "override-token", restConfig.BearerToken)
+		require.Equal(t, []byte("test-ca"), restConfig.CAData)
+		require.Equal(t, "porter", *namespace)
+	})
+
+	t.Run("server and token without a kubeconfig", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+		restConfig, _, err := GetRestConfig("porter", ConnectionConfig{Server: "https://api.example.com", Token: "test-token"})
+		require.NoError(t, err)
+		require.Equal(t, "https://api.example.com", restConfig.Host)
+		require.Equal(t, "test-token", restConfig.BearerToken)
+	})
+
+	t.Run("errors name the source", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config")
+		require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0600))
+
+		_, _, err := GetRestConfig("", ConnectionConfig{Kubeconfig: path, Context: "staging"})
+		require.ErrorContains(t, err, "could not load the cluster connection from the kubeconfig file "+path+" with context staging")
+
+		_, _, err = GetRestConfig("", ConnectionConfig{KubeconfigData: "not yaml: ["})
+		require.ErrorContains(t, err, "could not load the cluster connection from the kubeconfigData setting")
+	})
+}
+
+func TestGetRestConfig_Impersonate(t *testing.T) {
+	restConfig, _, err := GetRestConfig("", ConnectionConfig{
+		KubeconfigData:    testKubeconfig,
+		Impersonate:       "system:serviceaccount:tenant-a:installer",
+		ImpersonateGroups: []string{"porter-installers"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "system:serviceaccount:tenant-a:installer", restConfig.Impersonate.UserName)
+	require.Equal(t, []string{"porter-installers"}, restConfig.Impersonate.Groups)
+	require.Equal(t, "admin-token", restConfig.BearerToken, "the credentials of the impersonating user should be kept")
+}
+
+func TestGetRestConfig_RateLimit(t *testing.T) {
+	restConfig, _, err := GetRestConfig("", ConnectionConfig{KubeconfigData: testKubeconfig, QPS: 50, Burst: 100})
+	require.NoError(t, err)
+	require.Equal(t, float32(50), restConfig.QPS)
+	require.Equal(t, 100, restConfig.Burst)
+}
+
+func TestConnectionConfig_Validate(t *testing.T) {
+	require.NoError(t, ConnectionConfig{}.Validate())
+	require.NoError(t, ConnectionConfig{InCluster: true}.Validate())
+	require.NoError(t, ConnectionConfig{Kubeconfig: "config", Context: "dev", TokenFile: "token"}.Validate())
+	require.EqualError(t, ConnectionConfig{Kubeconfig: "config", KubeconfigData: "data"}.Validate(),
+		"invalid connection settings: only one of kubeconfig and kubeconfigData may be set")
+	require.EqualError(t, ConnectionConfig{InCluster: true, Context: "dev"}.Validate(),
+		"invalid connection settings: inCluster can't be combined with other connection settings")
+
+	require.NoError(t, ConnectionConfig{InCluster: true, Impersonate: "jane", ImpersonateGroups: []string{"developers"}}.Validate())
+	require.NoError(t, ConnectionConfig{Impersonate: "system:serviceaccount:tenant-a:installer"}.Validate())
+	require.EqualError(t, ConnectionConfig{ImpersonateGroups: []string{"developers"}}.Validate(),
+		"invalid connection settings: impersonateGroups requires impersonate")
+	require.EqualError(t, ConnectionConfig{Impersonate: "system:serviceaccount:installer"}.Validate(),
+		`invalid impersonate "system:serviceaccount:installer": expected system:serviceaccount:NAMESPACE:NAME`)
+	require.ErrorContains(t, ConnectionConfig{Impersonate: "system:serviceaccount:Tenant_A:installer"}.Validate(),
+		`invalid namespace "Tenant_A"`)
+}
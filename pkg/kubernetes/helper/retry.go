@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+const (
+	// DefaultTimeout limits each API call when the timeout is not configured.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultMaxAttempts is the number of times an API call is made, when
+	// it keeps failing with a retryable error.
+	DefaultMaxAttempts = 5
+
+	// DefaultInitialBackoff is the delay before the first retry, which is
+	// doubled for each later retry.
+	DefaultInitialBackoff = 250 * time.Millisecond
+
+	// maxBackoff is the longest delay between retries, unless the API
+	// server asks to wait longer.
+	maxBackoff = 10 * time.Second
+)
+
+// Whether an API call may be retried after the API server processed it.
+const (
+	Idempotent    = true
+	NotIdempotent = false
+)
+
+// RetryConfig configures the timeout of each API call, and how calls that
+// fail with a retryable error, such as a throttled or briefly unavailable
+// API server, are retried.
+type RetryConfig struct {
+	// Timeout limits each attempt of an API call, such as 10s. Defaults to 30s.
+	Timeout string `mapstructure:"timeout"`
+
+	// MaxAttempts is the number of attempts of an API call, including the
+	// first. Defaults to 5, and 1 disables retries.
+	MaxAttempts int `mapstructure:"maxAttempts"`
+
+	// InitialBackoff is the delay before the first retry, such as 500ms,
+	// which is doubled for each later retry. Defaults to 250ms.
+	InitialBackoff string `mapstructure:"initialBackoff"`
+}
+
+// Validate checks that the durations can be parsed.
+func (c RetryConfig) Validate() error {
+	_, err := NewRetrier(c)
+	return err
+}
+
+// Retrier makes API calls with a timeout, and retries them with
+// exponential backoff.
+type Retrier struct {
+	timeout        time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+}
+
+func NewRetrier(c RetryConfig) (Retrier, error) {
+	r := Retrier{timeout: DefaultTimeout, maxAttempts: DefaultMaxAttempts, initialBackoff: DefaultInitialBackoff}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil || timeout <= 0 {
+			return Retrier{}, fmt.Errorf("invalid retry timeout %q, expected a positive duration such as 10s", c.Timeout)
+		}
+		r.timeout = timeout
+	}
+	if c.MaxAttempts < 0 {
+		return Retrier{}, fmt.Errorf("invalid retry maxAttempts %d, expected at least 1", c.MaxAttempts)
+	}
+	if c.MaxAttempts > 0 {
+		r.maxAttempts = c.MaxAttempts
+	}
+	if c.InitialBackoff != "" {
+		backoff, err := time.ParseDuration(c.InitialBackoff)
+		if err != nil || backoff < 0 {
+			return Retrier{}, fmt.Errorf("invalid retry initialBackoff %q, expected a duration such as 500ms", c.InitialBackoff)
+		}
+		r.initialBackoff = backoff
+	}
+	return r, nil
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable,
+// or the attempts are used up. Each attempt is limited by the timeout. Calls
+// that are not idempotent, such as creating a secret, are only retried when
+// the API server did not process the request. When fn was called more than
+// once, the error reports the number of attempts.
+func (r Retrier) Do(ctx context.Context, idempotent bool, fn func(ctx context.Context) error) error {
+	backoff := r.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.attempt(ctx, fn)
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.maxAttempts || !isRetryable(ctx, err, idempotent) {
+			if attempt > 1 {
+				return fmt.Errorf("%w (failed after %d attempts)", err, attempt)
+			}
+			return err
+		}
+
+		delay := backoff
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && time.Duration(seconds)*time.Second > delay {
+			delay = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up after %d attempts: %v)", err, attempt, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Call makes an API call with the retrier, and returns its result. Calls that
+// are not idempotent, such as creating a secret, are only retried when the
+// request was not processed.
+func Call[T any](ctx context.Context, r Retrier, idempotent bool, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := r.Do(ctx, idempotent, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (r Retrier) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// isRetryable determines if a failed call may succeed when it is retried.
+func isRetryable(ctx context.Context, err error, idempotent bool) bool {
+	// The caller gave up, rather than the attempt timing out
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// The request was rejected before it was processed
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err) || utilnet.IsConnectionRefused(err) {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsInternalError(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) || utilnet.IsHTTP2ConnectionLost(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,138 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var secretsResource = schema.GroupResource{Resource: "secrets"}
+
+func newTestRetrier(t *testing.T, cfg RetryConfig) Retrier {
+	if cfg.InitialBackoff == "" {
+		cfg.InitialBackoff = "1ms"
+	}
+	r, err := NewRetrier(cfg)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRetrier_Do(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries throttled calls", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{})
+		attempts := 0
+		err := r.Do(ctx, NotIdempotent, func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return apierrors.NewTooManyRequests("slow down", 0)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("reports the attempts", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{MaxAttempts: 3})
+		attempts := 0
+		err := r.Do(ctx, Idempotent, func(ctx context.Context) error {
+			attempts++
+			return apierrors.NewServiceUnavailable("unavailable")
+		})
+		require.True(t, apierrors.IsServiceUnavailable(err))
+		require.EqualError(t, err, "unavailable (failed after 3 attempts)")
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry errors that are not retryable", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{})
+		attempts := 0
+		err := r.Do(ctx, Idempotent, func(ctx context.Context) error {
+			attempts++
+			return apierrors.NewNotFound(secretsResource, "password")
+		})
+		require.True(t, apierrors.IsNotFound(err))
+		require.EqualError(t, err, `secrets "password" not found`)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("only retries unprocessed calls that are not idempotent", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{})
+		attempts := 0
+		err := r.Do(ctx, NotIdempotent, func(ctx context.Context) error {
+			attempts++
+			return apierrors.NewInternalError(errors.New("etcd timeout"))
+		})
+		require.True(t, apierrors.IsInternalError(err))
+		require.Equal(t, 1, attempts)
+
+		attempts = 0
+		err = r.Do(ctx, NotIdempotent, func(ctx context.Context) error {
+			attempts++
+			if attempts == 1 {
+				return syscall.ECONNREFUSED
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+	})
+
+	t.Run("limits each attempt", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{Timeout: "10ms", MaxAttempts: 2})
+		attempts := 0
+		err := r.Do(ctx, Idempotent, func(ctx context.Context) error {
+			attempts++
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.EqualError(t, err, "context deadline exceeded (failed after 2 attempts)")
+	})
+
+	t.Run("stops when the caller gives up", func(t *testing.T) {
+		r := newTestRetrier(t, RetryConfig{InitialBackoff: "1h"})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		err := r.Do(ctx, Idempotent, func(ctx context.Context) error {
+			return apierrors.NewTooManyRequests("slow down", 0)
+		})
+		require.ErrorContains(t, err, "gave up after 1 attempts")
+	})
+}
+
+func TestCall(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRetrier(t, RetryConfig{})
+
+	attempts := 0
+	got, err := Call(ctx, r, Idempotent, func(ctx context.Context) (string, error) {
+		attempts++
+		if attempts < 2 {
+			return "", apierrors.NewServiceUnavailable("unavailable")
+		}
+		return "password", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "password", got)
+	require.Equal(t, 2, attempts)
+
+	_, err = Call(ctx, r, NotIdempotent, func(ctx context.Context) (string, error) {
+		return "", apierrors.NewNotFound(secretsResource, "password")
+	})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func TestRetryConfig_Validate(t *testing.T) {
+	require.NoError(t, RetryConfig{Timeout: "10s", MaxAttempts: 1, InitialBackoff: "500ms"}.Validate())
+	require.EqualError(t, RetryConfig{Timeout: "ten seconds"}.Validate(), `invalid retry timeout "ten seconds", expected a positive duration such as 10s`)
+	require.EqualError(t, RetryConfig{MaxAttempts: -1}.Validate(), "invalid retry maxAttempts -1, expected at least 1")
+}
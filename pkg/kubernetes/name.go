@@ -0,0 +1,41 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"github.com/pkg/errors"
+)
+
+type SecretNameOptions struct {
+	Key string
+}
+
+func (o *SecretNameOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("The positional argument KEY was not specified")
+	}
+	if len(args) > 1 {
+		return errors.New("Multiple positional arguments were specified but only one, KEY is expected")
+	}
+
+	o.Key = args[0]
+	return nil
+}
+
+// PrintSecretName prints the name of the Kubernetes secret that holds the
+// value of a Porter key, in the same [NAMESPACE/]NAME[#KEY] form used by
+// Porter's parameter and credential sets.
+func (p *Plugin) PrintSecretName(opts SecretNameOptions) error {
+	ref, err := secrets.ParseReference(opts.Key)
+	if err != nil {
+		return err
+	}
+
+	name := secrets.KubernetesName(ref.Name)
+	if ref.Namespace != "" {
+		name = ref.Namespace + secrets.NamespaceSeparator + name
+	}
+	fmt.Fprintln(p.Out, name)
+	return nil
+}
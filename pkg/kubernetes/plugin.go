@@ -3,7 +3,9 @@ package kubernetes
 import (
 	"bufio"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"os"
 
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/config"
 	"get.porter.sh/porter/pkg/portercontext"
@@ -22,21 +24,60 @@ func New() *Plugin {
 	}
 }
 
+// LoadConfig reads the plugin configuration from stdin. Nothing is read when
+// stdin is a terminal, so that commands run by hand don't wait for input
+// that will never come.
 func (p *Plugin) LoadConfig() error {
+	if isTerminal(p.In) {
+		return nil
+	}
+
 	reader := bufio.NewReader(p.In)
 	b, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return errors.Wrap(err, "could not read stdin")
 	}
 
+	return p.parseConfig(b, "stdin")
+}
+
+// LoadConfigFile reads the plugin configuration from a JSON file, or from
+// stdin when no file is specified.
+func (p *Plugin) LoadConfigFile(path string) error {
+	if path == "" {
+		return p.LoadConfig()
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "could not read the plugin configuration from %s", path)
+	}
+
+	return p.parseConfig(b, path)
+}
+
+func (p *Plugin) parseConfig(b []byte, source string) error {
 	if len(b) == 0 {
 		return nil
 	}
 
-	err = json.Unmarshal(b, &p.Config)
+	err := json.Unmarshal(b, &p.Config)
 	if err != nil {
-		return errors.Wrapf(err, "error unmarshaling stdin %q as kubernetes.Config", string(b))
+		return errors.Wrapf(err, "error unmarshaling %s %q as kubernetes.Config", source, string(b))
 	}
 
 	return nil
 }
+
+// isTerminal returns true when the reader is an interactive terminal.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
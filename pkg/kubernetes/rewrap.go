@@ -0,0 +1,69 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"github.com/pkg/errors"
+)
+
+type RewrapSecretsOptions struct {
+	Keys []string
+
+	// All rewraps every encrypted secret created by the plugin in the namespace.
+	All bool
+
+	// Namespace overrides the namespace from the plugin configuration.
+	Namespace string
+
+	// ConfigFile is a JSON file with the plugin configuration. Defaults to stdin.
+	ConfigFile string
+}
+
+func (o *RewrapSecretsOptions) Validate(args []string) error {
+	if o.All && len(args) > 0 {
+		return errors.New("The positional argument KEY cannot be specified with --all")
+	}
+	if !o.All && len(args) == 0 {
+		return errors.New("The positional argument KEY was not specified, or use --all to rewrap every secret")
+	}
+
+	o.Keys = args
+	return nil
+}
+
+// RewrapSecrets wraps the data keys of secrets encrypted by the
+// kubernetes.secrets plugin with the current key-encryption key, after the
+// key has been rotated. The plugin configuration is read from the config
+// file, or from stdin, in the same format that Porter passes it to the plugin.
+func (p *Plugin) RewrapSecrets(ctx context.Context, opts RewrapSecretsOptions) error {
+	if err := p.LoadConfigFile(opts.ConfigFile); err != nil {
+		return err
+	}
+	if opts.Namespace != "" {
+		p.Namespace = opts.Namespace
+	}
+
+	cfg, err := secrets.NewPluginConfig(p.Context, p.Config)
+	if err != nil {
+		return err
+	}
+	store := secrets.NewStore(p.Context, cfg)
+
+	if opts.All {
+		count, err := store.RewrapAll(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.Out, "Rewrapped %d secrets\n", count)
+		return nil
+	}
+
+	for _, key := range opts.Keys {
+		if err := store.Rewrap(ctx, secrets.SecretSourceType, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
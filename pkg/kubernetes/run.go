@@ -6,9 +6,11 @@ import (
 
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/config"
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/storage"
 	"get.porter.sh/porter/pkg/plugins"
 	"get.porter.sh/porter/pkg/portercontext"
 	secretplugins "get.porter.sh/porter/pkg/secrets/plugins"
+	storageplugins "get.porter.sh/porter/pkg/storage/plugins"
 	"github.com/hashicorp/go-hclog"
 	hplugin "github.com/hashicorp/go-plugin"
 	"github.com/pkg/errors"
@@ -69,7 +71,7 @@ func (p *Plugin) Run(args []string) {
 		logger.Error(err.Error())
 		return
 	}
-	plugins.Serve(p.Context, opts.selectedInterface, opts.selectedPlugin, secretplugins.PluginProtocolVersion)
+	plugins.Serve(p.Context, opts.selectedInterface, opts.selectedPlugin, getProtocolVersion(opts.selectedInterface))
 }
 
 type pluginInitializer func(ctx *portercontext.Context, cfg config.Config) (hplugin.Plugin, error)
@@ -78,5 +80,13 @@ func getPlugins() map[string]pluginInitializer {
 
 	return map[string]pluginInitializer{
 		secrets.PluginKey: secrets.NewPlugin,
+		storage.PluginKey: storage.NewPlugin,
 	}
 }
+
+func getProtocolVersion(pluginInterface string) int {
+	if pluginInterface == storageplugins.PluginInterface {
+		return storageplugins.PluginProtocolVersion
+	}
+	return secretplugins.PluginProtocolVersion
+}
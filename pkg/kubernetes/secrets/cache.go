@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func validatePrefetchSelector(selector string) error {
+	if _, err := labels.Parse(selector); err != nil {
+		return fmt.Errorf("invalid prefetchSelector %q: %w", selector, err)
+	}
+	return nil
+}
+
+// prefetchSecrets lists the secrets in the configured namespace once, and
+// caches them in Secrets, so that a large credential set is resolved with a
+// single API call. When the list fails, the secrets are read one at a time.
+func (s *Store) prefetchSecrets(ctx context.Context) {
+	if !s.prefetch {
+		return
+	}
+	s.prefetchOnce.Do(func() {
+		s.listSecrets(ctx)
+	})
+}
+
+func (s *Store) listSecrets(ctx context.Context) {
+	list, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.SecretList, error) {
+		return s.clientSet.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: s.prefetchSelector})
+	})
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("Store.prefetchSecrets: could not list the secrets in namespace %s, they will be read individually: %s", s.namespace, err))
+		return
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.prefetchSecrets: ns:%s, selector:%s, secrets:%d", s.namespace, s.prefetchSelector, len(list.Items)))
+	for i := range list.Items {
+		s.cacheSecret(s.namespace, &list.Items[i])
+	}
+}
+
+// cachedSecret returns a secret from the cache, prefetching the secrets in
+// the configured namespace on first use.
+func (s *Store) cachedSecret(ctx context.Context, namespace string, name string) (*v1.Secret, bool) {
+	if !s.prefetch {
+		return nil, false
+	}
+	if namespace == s.namespace {
+		s.prefetchSecrets(ctx)
+	}
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	secret, ok := s.Secrets[namespace][name]
+	return secret, ok
+}
+
+// cachedSecretByKey returns the secret that holds the value of a key from
+// the cache, like getByKey. A secret with the legacy SanitizeKey name is only
+// returned when every secret in the namespace was prefetched, otherwise the
+// secret with the KubernetesName may exist but not be cached.
+func (s *Store) cachedSecretByKey(ctx context.Context, namespace string, ref SecretReference) (*v1.Secret, bool, error) {
+	secret, ok := s.cachedSecret(ctx, namespace, KubernetesName(ref.Name))
+	if !ok && namespace == s.namespace && s.prefetchSelector == "" {
+		secret, ok = s.cachedSecret(ctx, namespace, SanitizeKey(ref.Name))
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if err := checkKey("secret", namespace, secret, ref.Name); err != nil {
+		return nil, true, err
+	}
+	return secret, true, nil
+}
+
+// cacheSecret adds a secret that was read or written to the cache.
+func (s *Store) cacheSecret(namespace string, secret *v1.Secret) {
+	if !s.prefetch {
+		return
+	}
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if s.Secrets[namespace] == nil {
+		s.Secrets[namespace] = make(map[string]*v1.Secret)
+	}
+	s.Secrets[namespace][secret.Name] = secret
+}
+
+// uncacheSecret removes a secret that was changed or deleted from the cache.
+func (s *Store) uncacheSecret(namespace string, name string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	delete(s.Secrets[namespace], name)
+}
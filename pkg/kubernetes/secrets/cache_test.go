@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// secretActions returns the verbs of the API calls made for secrets.
+func secretActions(s *Store) []string {
+	var verbs []string
+	for _, action := range s.clientSet.(*fake.Clientset).Actions() {
+		if action.GetResource().Resource == "secrets" {
+			verbs = append(verbs, action.GetVerb())
+		}
+	}
+	return verbs
+}
+
+func TestStore_Prefetch(t *testing.T) {
+	ctx := context.Background()
+	objects := []runtime.Object{
+		newSecret("db-password", map[string]string{"value": "db"}),
+		newSecret("api-key", map[string]string{"value": "api"}),
+		newSecret("token", map[string]string{"value": "token"}),
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, objects...)
+		for _, name := range []string{"db-password", "api-key"} {
+			_, err := s.Resolve(ctx, SecretSourceType, name)
+			require.NoError(t, err)
+		}
+		require.Equal(t, []string{"get", "get"}, secretActions(s))
+		require.Empty(t, s.Secrets)
+	})
+
+	t.Run("lists the namespace once", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Prefetch: true}, objects...)
+		for name, want := range map[string]string{"db-password": "db", "api-key": "api", "token": "token"} {
+			got, err := s.Resolve(ctx, SecretSourceType, name)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		}
+		require.Equal(t, []string{"list"}, secretActions(s))
+		require.Len(t, s.Secrets[testNamespace], 3)
+	})
+
+	t.Run("falls back to get on a miss", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Prefetch: true, PrefetchSelector: "porter.sh/expose=true"}, objects...)
+
+		got, err := s.Resolve(ctx, SecretSourceType, "api-key")
+		require.NoError(t, err)
+		require.Equal(t, "api", got)
+		_, err = s.Resolve(ctx, SecretSourceType, "api-key")
+		require.NoError(t, err)
+		require.Equal(t, []string{"list", "get"}, secretActions(s), "the secret should be cached after it is read")
+
+		list := s.clientSet.(*fake.Clientset).Actions()[0].(k8stesting.ListAction)
+		require.Equal(t, "porter.sh/expose=true", list.GetListRestrictions().Labels.String())
+	})
+
+	t.Run("legacy names are only trusted when the namespace is listed", func(t *testing.T) {
+		legacy := newSecret(SanitizeKey("My_Output"), map[string]string{SecretDataKey: "legacy"})
+		legacy.Labels = map[string]string{"porter.sh/expose": "true"}
+		current := newSecret(KubernetesName("My_Output"), map[string]string{SecretDataKey: "current"})
+		current.Annotations = map[string]string{KeyAnnotation: "My_Output"}
+		s := newTestStore(t, PluginConfig{Prefetch: true, PrefetchSelector: "porter.sh/expose=true"}, legacy, current)
+
+		got, err := s.Resolve(ctx, SecretSourceType, "My_Output")
+		require.NoError(t, err)
+		require.Equal(t, "current", got, "the secret excluded by the selector should be read")
+		require.Equal(t, []string{"list", "get"}, secretActions(s))
+	})
+
+	t.Run("resolves concurrently", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Prefetch: true, Clusters: map[string]ClusterProfile{"workload": {Namespace: testNamespace}}}, objects...)
+		s.clusterStore("workload").clientSet = fake.NewSimpleClientset(objects...)
+
+		var wg sync.WaitGroup
+		for _, name := range []string{"db-password", "api-key", "token", "workload:token", "missing"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = s.Resolve(ctx, SecretSourceType, name)
+				_ = s.Create(ctx, SecretSourceType, name+"-output", "value")
+			}()
+		}
+		wg.Wait()
+		// Values are not written to cluster profiles
+		require.Len(t, s.Secrets[testNamespace], 7)
+	})
+
+	t.Run("create writes through", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Prefetch: true})
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "from create"))
+		got, err := s.Resolve(ctx, SecretSourceType, "output")
+		require.NoError(t, err)
+		require.Equal(t, "from create", got)
+		require.Equal(t, []string{"create", "list"}, secretActions(s))
+
+		require.NoError(t, s.Delete(ctx, SecretSourceType, "output"))
+		_, err = s.Resolve(ctx, SecretSourceType, "output")
+		require.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestValidatePrefetchSelector(t *testing.T) {
+	require.NoError(t, validatePrefetchSelector(""))
+	require.NoError(t, validatePrefetchSelector("porter.sh/expose=true,team in (a,b)"))
+	require.ErrorContains(t, validatePrefetchSelector("team in a"), `invalid prefetchSelector "team in a"`)
+}
@@ -0,0 +1,286 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ChunkIndexDataKey is the data key of an index secret, which lists the
+	// chunks that hold a value that was too large for a single secret.
+	ChunkIndexDataKey = "porter-chunk-index"
+
+	// ChunkDataKey is the data key of a chunk secret.
+	ChunkDataKey = "chunk"
+
+	// ChunkOfAnnotation records the name of the index secret on each chunk.
+	ChunkOfAnnotation = "secrets.porter.sh/chunk-of"
+)
+
+// chunkIndex is stored in the index secret, and records the order and
+// checksums of the chunks.
+type chunkIndex struct {
+	// Size of the complete value in bytes.
+	Size int `json:"size"`
+
+	// SHA256 checksum of the complete value.
+	SHA256 string `json:"sha256"`
+
+	// Chunks in the order that they are joined.
+	Chunks []chunkRef `json:"chunks"`
+}
+
+type chunkRef struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isChunkIndex(secret *v1.Secret) bool {
+	_, ok := secret.Data[ChunkIndexDataKey]
+	return ok
+}
+
+// chunkName returns the name of a chunk secret. The name includes the
+// checksum of the chunk, so that chunks of different values never collide.
+func chunkName(indexName string, i int, sum string) string {
+	suffix := fmt.Sprintf("-chunk-%d-%s", i, sum[:10])
+	maxLength := validation.DNS1123SubdomainMaxLength - len(suffix)
+	if len(indexName) > maxLength {
+		indexName = strings.TrimRight(indexName[:maxLength], "-.")
+	}
+	return indexName + suffix
+}
+
+// createChunked stores a large value as an index secret and the chunk
+// secrets that it lists. The chunks are created first, so that the index
+// never lists a chunk that doesn't exist yet, and are then owned by the
+// index, so that they are garbage collected by Kubernetes if the index is
+// deleted by someone else. The original value, before it was encoded, is
+// compared with the existing value when the index already exists.
+func (s *Store) createChunked(ctx context.Context, namespace string, meta metav1.ObjectMeta, value []byte, original []byte) error {
+	index := chunkIndex{Size: len(value), SHA256: checksum(value)}
+	var chunks []*v1.Secret
+	for i := 0; i*s.chunkSize < len(value); i++ {
+		end := (i + 1) * s.chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		data := value[i*s.chunkSize : end]
+		sum := checksum(data)
+
+		chunkMeta := *meta.DeepCopy()
+		chunkMeta.Name = chunkName(meta.Name, i, sum)
+		chunkMeta.Annotations[ChunkOfAnnotation] = meta.Name
+		// The data key is only recorded on the index, so that it is rewrapped in one place
+		delete(chunkMeta.Annotations, KeyIDAnnotation)
+		delete(chunkMeta.Annotations, WrappedKeyAnnotation)
+		Immutable := s.immutable
+		chunks = append(chunks, &v1.Secret{ObjectMeta: chunkMeta, Immutable: &Immutable, Data: map[string][]byte{ChunkDataKey: data}})
+		index.Chunks = append(index.Chunks, chunkRef{Name: chunkMeta.Name, SHA256: sum})
+	}
+
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("could not marshal the chunk index for secret %s/%s: %w", namespace, meta.Name, err)
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.createChunked: ns:%s, name:%s, size:%d, chunks:%d", namespace, meta.Name, len(value), len(chunks)))
+
+	// Chunks that already exist hold the same data, because their name includes its checksum
+	var created []string
+	for i, chunk := range chunks {
+		ok, err := s.createChunk(ctx, namespace, chunk)
+		if err != nil {
+			s.removeChunks(ctx, namespace, created)
+			return fmt.Errorf("could not create chunk %d of %d for secret %s/%s: %w", i+1, len(chunks), namespace, meta.Name, err)
+		}
+		if ok {
+			created = append(created, chunk.Name)
+		}
+	}
+
+	Immutable := s.immutable
+	indexSecret := &v1.Secret{ObjectMeta: meta, Immutable: &Immutable, Data: map[string][]byte{ChunkIndexDataKey: indexData}}
+	stored, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Create(ctx, indexSecret, metav1.CreateOptions{})
+	})
+	replaced := true
+	if apierrors.IsAlreadyExists(err) && s.conflictPolicy != ConflictPolicyFail {
+		stored, replaced, err = s.handleConflict(ctx, namespace, indexSecret, ChunkIndexDataKey, original)
+	}
+	if err != nil || !replaced {
+		// The existing index doesn't list the chunks that were created
+		s.removeChunks(ctx, namespace, created)
+		if err != nil {
+			return err
+		}
+		s.cacheSecret(namespace, stored)
+		return nil
+	}
+	s.cacheSecret(namespace, stored)
+
+	owner := metav1.OwnerReference{APIVersion: "v1", Kind: "Secret", Name: stored.Name, UID: stored.UID}
+	for _, chunk := range chunks {
+		if err := s.setChunkOwner(ctx, namespace, chunk.Name, owner); err != nil {
+			// The chunks are still removed with the index by the plugin
+			s.logger.Warn(fmt.Sprintf("Store.createChunked: could not set the owner of chunk %s/%s to secret %s/%s: %s", namespace, chunk.Name, namespace, stored.Name, err))
+		}
+	}
+	return nil
+}
+
+// createChunk creates a chunk secret, and returns true when it was created.
+// A chunk with the same name already holds the same data, and is reused.
+func (s *Store) createChunk(ctx context.Context, namespace string, chunk *v1.Secret) (bool, error) {
+	_, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Create(ctx, chunk, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// setChunkOwner makes the index secret the only owner of a chunk. A chunk
+// that is reused from an index that was replaced is owned by the new index.
+func (s *Store) setChunkOwner(ctx context.Context, namespace string, name string, owner metav1.OwnerReference) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"ownerReferences": []metav1.OwnerReference{owner}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	})
+	return err
+}
+
+// removeChunks deletes chunks that are not listed by an index. Failures are
+// logged and ignored, because the value was not stored.
+func (s *Store) removeChunks(ctx context.Context, namespace string, names []string) {
+	for _, name := range names {
+		err := s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+			return s.clientSet.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			s.logger.Warn(fmt.Sprintf("Store.removeChunks: could not delete chunk %s/%s: %s", namespace, name, err))
+		}
+	}
+}
+
+// getChunk gets a chunk secret, from the cache when the secrets were
+// prefetched. An index may list any secret in its namespace, so the chunk
+// must be exposed like the index.
+func (s *Store) getChunk(ctx context.Context, namespace string, name string) (*v1.Secret, error) {
+	chunk, ok := s.cachedSecret(ctx, namespace, name)
+	if !ok {
+		var err error
+		chunk, err = k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.Secret, error) {
+			return s.clientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkExposed(namespace, chunk); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+func parseChunkIndex(namespace string, secret *v1.Secret) (chunkIndex, error) {
+	var index chunkIndex
+	if err := json.Unmarshal(secret.Data[ChunkIndexDataKey], &index); err != nil {
+		return chunkIndex{}, ChunkError{msg: fmt.Sprintf("the chunk index in secret %s/%s is corrupt: %s", namespace, secret.Name, err)}
+	}
+	return index, nil
+}
+
+// readChunks reassembles a large value from the chunks listed in an index
+// secret, verifying the checksum of each chunk and of the complete value.
+func (s *Store) readChunks(ctx context.Context, namespace string, secret *v1.Secret) ([]byte, error) {
+	index, err := parseChunkIndex(namespace, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.readChunks: ns:%s, name:%s, chunks:%d", namespace, secret.Name, len(index.Chunks)))
+
+	value := bytes.NewBuffer(make([]byte, 0, index.Size))
+	for i, ref := range index.Chunks {
+		chunk, err := s.getChunk(ctx, namespace, ref.Name)
+		if apierrors.IsNotFound(err) {
+			return nil, ChunkError{msg: fmt.Sprintf("chunk %d of %d (%s/%s) of secret %s/%s is missing",
+				i+1, len(index.Chunks), namespace, ref.Name, namespace, secret.Name)}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not get chunk %d of %d (%s/%s) of secret %s/%s: %w",
+				i+1, len(index.Chunks), namespace, ref.Name, namespace, secret.Name, err)
+		}
+
+		data := chunk.Data[ChunkDataKey]
+		if checksum(data) != ref.SHA256 {
+			return nil, ChunkError{msg: fmt.Sprintf("chunk %d of %d (%s/%s) of secret %s/%s is corrupt: the checksum does not match",
+				i+1, len(index.Chunks), namespace, ref.Name, namespace, secret.Name)}
+		}
+		value.Write(data)
+	}
+
+	if value.Len() != index.Size || checksum(value.Bytes()) != index.SHA256 {
+		return nil, ChunkError{msg: fmt.Sprintf("the value reassembled from the chunks of secret %s/%s is corrupt: the checksum does not match",
+			namespace, secret.Name)}
+	}
+	return value.Bytes(), nil
+}
+
+// deleteChunks removes the chunks listed by an index secret, except those
+// that are also listed by its replacement, which may be nil. Secrets that
+// are not an index are ignored.
+func (s *Store) deleteChunks(ctx context.Context, namespace string, secret *v1.Secret, replacement *v1.Secret) error {
+	if !isChunkIndex(secret) {
+		return nil
+	}
+	index, err := parseChunkIndex(namespace, secret)
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	if replacement != nil && isChunkIndex(replacement) {
+		if replacementIndex, err := parseChunkIndex(namespace, replacement); err == nil {
+			for _, ref := range replacementIndex.Chunks {
+				used[ref.Name] = true
+			}
+		}
+	}
+
+	for _, ref := range index.Chunks {
+		if used[ref.Name] {
+			continue
+		}
+		err := s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+			return s.clientSet.CoreV1().Secrets(namespace).Delete(ctx, ref.Name, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("could not delete chunk %s/%s of secret %s/%s: %w", namespace, ref.Name, namespace, secret.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newChunkedTestStore(t *testing.T, cfg PluginConfig) *Store {
+	s := newTestStore(t, cfg)
+	s.chunkSize = 4
+	return s
+}
+
+func TestStore_Chunks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round trip", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+
+		secrets, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, secrets.Items, 4, "expected an index and 3 chunks")
+
+		got, err := s.Resolve(ctx, SecretSourceType, "state")
+		require.NoError(t, err)
+		require.Equal(t, "0123456789", got)
+	})
+
+	t.Run("values that fit in a secret are not chunked", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "small", "0123"))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "small", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.False(t, isChunkIndex(secret))
+	})
+
+	t.Run("missing chunk", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+		name := chunkName("state", 1, checksum([]byte("4567")))
+		require.NoError(t, s.clientSet.CoreV1().Secrets(testNamespace).Delete(ctx, name, metav1.DeleteOptions{}))
+
+		_, err := s.Resolve(ctx, SecretSourceType, "state")
+		require.ErrorAs(t, err, &ChunkError{})
+		require.EqualError(t, err, "chunk 2 of 3 (porter/"+name+") of secret porter/state is missing")
+	})
+
+	t.Run("corrupt chunk", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{Immutable: new(bool)})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+		name := chunkName("state", 2, checksum([]byte("89")))
+		chunk, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		chunk.Data[ChunkDataKey] = []byte("xx")
+		_, err = s.clientSet.CoreV1().Secrets(testNamespace).Update(ctx, chunk, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "state")
+		require.ErrorAs(t, err, &ChunkError{})
+		require.Contains(t, err.Error(), "chunk 3 of 3")
+		require.Contains(t, err.Error(), "is corrupt")
+	})
+
+	t.Run("chunks must be exposed", func(t *testing.T) {
+		index, err := json.Marshal(chunkIndex{Size: 6, SHA256: checksum([]byte("hidden")), Chunks: []chunkRef{{Name: "private", SHA256: checksum([]byte("hidden"))}}})
+		require.NoError(t, err)
+		state := newSecret("state", map[string]string{ChunkIndexDataKey: string(index)})
+		state.Labels = map[string]string{"porter.sh/expose": "true"}
+		s := newChunkedTestStore(t, PluginConfig{ExposeLabel: "porter.sh/expose"})
+		s.clientSet = fake.NewSimpleClientset(state, newSecret("private", map[string]string{ChunkDataKey: "hidden"}))
+
+		_, err = s.Resolve(ctx, SecretSourceType, "state")
+		require.ErrorAs(t, err, &SecretNotExposedError{})
+	})
+
+	t.Run("delete removes the chunks", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+
+		require.NoError(t, s.Delete(ctx, SecretSourceType, "state"))
+		secrets, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Empty(t, secrets.Items)
+	})
+
+	t.Run("replace a chunked value", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "abcdef"))
+		got, err := s.Resolve(ctx, SecretSourceType, "state")
+		require.NoError(t, err)
+		require.Equal(t, "abcdef", got)
+		secrets, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, secrets.Items, 3, "the old chunks should be removed")
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "abc"))
+		secrets, err = s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, secrets.Items, 1, "replacing with a small value should remove the chunks")
+	})
+
+	t.Run("idempotent chunked value", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newChunkedTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyIdempotent, Encryption: EncryptionConfig{KeyFile: keyFile}})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+		secrets, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		want := len(secrets.Items)
+
+		// Encrypted chunks have different names every time they are stored
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+		secrets, err = s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, secrets.Items, want, "the chunks of the value that was not stored should be removed")
+	})
+
+	t.Run("chunks are created before the index", func(t *testing.T) {
+		s := newChunkedTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+
+		var created []string
+		for _, action := range s.clientSet.(*fake.Clientset).Actions() {
+			if create, ok := action.(k8stesting.CreateAction); ok {
+				created = append(created, create.GetObject().(*v1.Secret).Name)
+			}
+		}
+		require.Len(t, created, 4)
+		require.Equal(t, "state", created[3])
+
+		chunk, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, chunkName("state", 0, checksum([]byte("0123"))), metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, chunk.OwnerReferences, 1)
+		require.Equal(t, "state", chunk.OwnerReferences[0].Name)
+	})
+
+	t.Run("a failed replacement keeps the value", func(t *testing.T) {
+		immutable := false
+		s := newChunkedTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace, Immutable: &immutable})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "state", "0123456789"))
+		s.clientSet.(*fake.Clientset).PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(v1.Resource("secrets"), "state", errors.New("modified"))
+		})
+
+		require.Error(t, s.Create(ctx, SecretSourceType, "state", "abcdef"))
+		got, err := s.Resolve(ctx, SecretSourceType, "state")
+		require.NoError(t, err)
+		require.Equal(t, "0123456789", got)
+		secrets, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, secrets.Items, 4, "the chunks of the value that was not stored should be removed")
+	})
+}
+
+func TestChunkName(t *testing.T) {
+	sum := checksum([]byte("test"))
+	require.Equal(t, "state-chunk-0-"+sum[:10], chunkName("state", 0, sum))
+
+	long := chunkName(strings.Repeat("a", 250)+".b", 12, sum)
+	require.Empty(t, validation.IsDNS1123Subdomain(long), "chunk names should be valid secret names")
+}
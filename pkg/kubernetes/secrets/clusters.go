@@ -0,0 +1,103 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ClusterSeparator separates the cluster profile from the rest of a
+// reference, e.g. CLUSTER:NAMESPACE/NAME#KEY. References are only split when
+// the prefix is the name of a configured profile.
+const ClusterSeparator = ":"
+
+// ClusterProfile is a named cluster that values may be resolved from, in
+// addition to the cluster that the plugin is configured to use.
+type ClusterProfile struct {
+	// Namespace is used by references that don't specify one. Defaults to the
+	// namespace of the profile's kubeconfig context.
+	Namespace string `mapstructure:"namespace"`
+
+	// ConnectionConfig selects the cluster of the profile.
+	k8shelper.ConnectionConfig `mapstructure:",squash"`
+}
+
+func validateClusters(clusters map[string]ClusterProfile) error {
+	for name, profile := range clusters {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return fmt.Errorf("invalid cluster profile name %q: %s", name, strings.Join(errs, ", "))
+		}
+		if profile.Namespace != "" {
+			if errs := validation.IsDNS1123Label(profile.Namespace); len(errs) > 0 {
+				return fmt.Errorf("invalid namespace %q for cluster profile %s: %s", profile.Namespace, name, strings.Join(errs, ", "))
+			}
+		}
+		if err := profile.ConnectionConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid cluster profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// splitCluster returns the cluster profile selected by a reference, and the
+// reference without the profile. The profile is empty when the reference
+// uses the default cluster.
+func (s *Store) splitCluster(keyValue string) (cluster string, ref string) {
+	name, rest, ok := strings.Cut(keyValue, ClusterSeparator)
+	if _, isProfile := s.clusters[name]; ok && isProfile {
+		return name, rest
+	}
+	return "", keyValue
+}
+
+// clusterStore returns the store that resolves values from a cluster
+// profile. It has its own connection to the profile's cluster, which is
+// created on first use, and its own cache.
+func (s *Store) clusterStore(cluster string) *Store {
+	s.clustersMu.Lock()
+	defer s.clustersMu.Unlock()
+	if cs, ok := s.clusterStores[cluster]; ok {
+		return cs
+	}
+
+	cs := NewStore(s.Context, profileConfig(s.config, s.clusters[cluster]))
+	cs.parent = s
+	s.clusterStores[cluster] = cs
+	return cs
+}
+
+// profileConfig returns the configuration of the store of a cluster profile.
+// Only the settings that control how values are resolved are copied, so
+// that the policy of the plugin applies to every cluster. Values are never
+// written to a cluster profile.
+func profileConfig(cfg PluginConfig, profile ClusterProfile) PluginConfig {
+	return PluginConfig{
+		Namespace:            profile.Namespace,
+		ConnectionConfig:     profile.ConnectionConfig,
+		DataKey:              cfg.DataKey,
+		FallbackDataKeys:     cfg.FallbackDataKeys,
+		TokenAudiences:       cfg.TokenAudiences,
+		TokenExpiration:      cfg.TokenExpiration,
+		TokenServiceAccounts: cfg.TokenServiceAccounts,
+		ExposeLabel:          cfg.ExposeLabel,
+		RequireGrants:        cfg.RequireGrants,
+		Prefetch:             cfg.Prefetch,
+		PrefetchSelector:     cfg.PrefetchSelector,
+		Retry:                cfg.Retry,
+		Policy:               cfg.Policy,
+		Encryption:           cfg.Encryption,
+		Logger:               cfg.Logger,
+	}
+}
+
+// checkDefaultCluster returns an error when a reference selects a cluster
+// profile. Profiles are only used to resolve values, and values are always
+// written to the default cluster.
+func (s *Store) checkDefaultCluster(keyValue string) error {
+	if cluster, _ := s.splitCluster(keyValue); cluster != "" {
+		return fmt.Errorf("invalid reference %q: values can only be resolved from the %s cluster profile, and are written to the default cluster", keyValue, cluster)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testProfileKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: workload
+  cluster:
+    server: https://workload.example.com
+users:
+- name: porter
+  user:
+    token: workload-token
+contexts:
+- name: workload
+  context:
+    cluster: workload
+    user: porter
+    namespace: apps
+current-context: workload
+`
+
+func TestStore_Resolve_ClusterProfiles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{Clusters: map[string]ClusterProfile{
+		"workload": {Namespace: "payments"},
+	}}, newSecret("db-creds", map[string]string{"value": "management password"}))
+
+	workloadSecret := newSecret("db-creds", map[string]string{"value": "workload password"})
+	workloadSecret.Namespace = "payments"
+	workload := s.clusterStore("workload")
+	workload.clientSet = fake.NewSimpleClientset(workloadSecret)
+	require.Same(t, workload, s.clusterStore("workload"), "the profile's store should be reused")
+
+	got, err := s.Resolve(ctx, SecretSourceType, "workload:db-creds")
+	require.NoError(t, err)
+	require.Equal(t, "workload password", got)
+
+	got, err = s.Resolve(ctx, SecretSourceType, "db-creds")
+	require.NoError(t, err)
+	require.Equal(t, "management password", got)
+
+	// Only configured profiles are split from the reference
+	_, err = s.Resolve(ctx, SecretSourceType, "staging:db-creds")
+	require.ErrorContains(t, err, "could not get secret staging:db-creds")
+
+	err = s.Create(ctx, SecretSourceType, "workload:output", "value")
+	require.EqualError(t, err, `invalid reference "workload:output": values can only be resolved from the workload cluster profile, and are written to the default cluster`)
+}
+
+func TestStore_ClusterProfiles_ConnectLazily(t *testing.T) {
+	s := newTestStore(t, PluginConfig{Clusters: map[string]ClusterProfile{
+		"workload": {ConnectionConfig: k8shelper.ConnectionConfig{KubeconfigData: testProfileKubeconfig}},
+	}})
+
+	workload := s.clusterStore("workload")
+	require.Nil(t, workload.clientSet)
+	require.NoError(t, workload.connect())
+	require.Equal(t, "https://workload.example.com", workload.restConfig.Host)
+	require.Equal(t, "apps", workload.namespace, "the namespace should default to the profile's kubeconfig context")
+	require.Equal(t, testNamespace, s.namespace)
+}
+
+func TestStore_ClusterProfiles_OwnCache(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{
+		Prefetch:    true,
+		ExposeLabel: "porter.sh/expose",
+		Clusters:    map[string]ClusterProfile{"workload": {Namespace: testNamespace}},
+	}, exposedSecret("db-creds", "management password"))
+
+	got, err := s.Resolve(ctx, SecretSourceType, "db-creds")
+	require.NoError(t, err)
+	require.Equal(t, "management password", got)
+
+	workload := s.clusterStore("workload")
+	workload.clientSet = fake.NewSimpleClientset(exposedSecret("api-key", "workload key"))
+	require.Equal(t, s.exposeKey, workload.exposeKey, "the profile's store should apply the same policy")
+
+	_, err = s.Resolve(ctx, SecretSourceType, "workload:db-creds")
+	require.ErrorContains(t, err, "could not get secret", "secrets prefetched from the default cluster should not be resolved from the profile")
+
+	got, err = s.Resolve(ctx, SecretSourceType, "workload:api-key")
+	require.NoError(t, err)
+	require.Equal(t, "workload key", got)
+}
+
+func exposedSecret(name string, value string) *v1.Secret {
+	secret := newSecret(name, map[string]string{"value": value})
+	secret.Labels = map[string]string{"porter.sh/expose": "true"}
+	return secret
+}
+
+func TestValidateClusters(t *testing.T) {
+	require.NoError(t, validateClusters(map[string]ClusterProfile{"workload-a": {Namespace: "apps"}}))
+	require.ErrorContains(t, validateClusters(map[string]ClusterProfile{"Workload_A": {}}), `invalid cluster profile name "Workload_A"`)
+	require.EqualError(t, validateClusters(map[string]ClusterProfile{"workload-a": {ConnectionConfig: k8shelper.ConnectionConfig{Token: "a", TokenFile: "b"}}}),
+		"invalid cluster profile workload-a: invalid connection settings: only one of token and tokenFile may be set")
+}
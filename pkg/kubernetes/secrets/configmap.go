@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapSourceType reads and writes non-sensitive values, such as region
+// names or endpoints, in ConfigMaps instead of secrets. ConfigMaps use the
+// same names, data keys and [NAMESPACE/]NAME[#KEY] references as secrets,
+// but their values are never chunked, compressed or encrypted.
+const ConfigMapSourceType = "configmap"
+
+func (s *Store) resolveConfigMap(ctx context.Context, keyValue string) (string, error) {
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return "", err
+	}
+	if ref.Registry != "" {
+		return "", fmt.Errorf("invalid configmap reference %q: registry credentials can only be resolved from secrets", keyValue)
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return "", err
+	}
+	if err := s.checkGrant(ctx, namespace, configMapGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return "", err
+	}
+
+	cm, err := getByKey(ctx, s, "configmap", namespace, ref, s.clientSet.CoreV1().ConfigMaps(namespace).Get)
+	if err != nil {
+		return "", fmt.Errorf("could not get configmap %s in namespace %s: %w", keyValue, namespace, err)
+	}
+
+	dataKeys := s.dataKeys(ref)
+	for _, dataKey := range dataKeys {
+		if val, ok := cm.Data[dataKey]; ok {
+			return val, nil
+		}
+		if val, ok := cm.BinaryData[dataKey]; ok {
+			return string(val), nil
+		}
+	}
+	return "", InvalidSecretDataKeyError{msg: fmt.Sprintf(`The configmap %s/%s does not have a key named %s. `+
+		`The kubernetes.secrets plugin requires that the Kubernetes configmap is named after the configmap referenced in the `+
+		`Porter parameter or credential set, and the value is stored in a key on the Kubernetes configmap named %s, `+
+		`or in the key specified with NAME%sKEY`,
+		namespace, ref.Name, strings.Join(dataKeys, " or "), strings.Join(dataKeys, " or "), DataKeySeparator)}
+}
+
+func (s *Store) createConfigMap(ctx context.Context, keyValue string, value string) error {
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return err
+	}
+	if ref.Registry != "" {
+		return fmt.Errorf("invalid configmap reference %q: registry credentials can only be resolved from secrets", keyValue)
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return err
+	}
+	if err := s.checkGrant(ctx, namespace, configMapGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return err
+	}
+
+	dataKey := ref.Key
+	if dataKey == "" {
+		dataKey = s.dataKey
+	}
+
+	Immutable := s.immutable
+	cm := &v1.ConfigMap{ObjectMeta: s.objectMeta(ref), Immutable: &Immutable, Data: map[string]string{dataKey: value}}
+	_, err = k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) && s.conflictPolicy != ConflictPolicyFail {
+		err = s.handleConfigMapConflict(ctx, namespace, cm, dataKey)
+	}
+	return err
+}
+
+// handleConfigMapConflict applies the idempotent or replace conflict policy
+// after createConfigMap found that the configmap already exists.
+func (s *Store) handleConfigMapConflict(ctx context.Context, namespace string, cm *v1.ConfigMap, dataKey string) error {
+	s.logger.Debug(fmt.Sprintf("Store.handleConfigMapConflict: ns:%s, name:%s, policy:%s", namespace, cm.Name, s.conflictPolicy))
+
+	existing, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, cm.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("could not get existing configmap %s/%s: %w", namespace, cm.Name, err)
+	}
+	if err := checkKey("configmap", namespace, existing, cm.Annotations[KeyAnnotation]); err != nil {
+		return err
+	}
+
+	if val, ok := existing.Data[dataKey]; ok && val == cm.Data[dataKey] {
+		return nil
+	}
+	if s.conflictPolicy == ConflictPolicyIdempotent {
+		return fmt.Errorf("configmap %s/%s already exists with a different value", namespace, cm.Name)
+	}
+
+	if existing.Labels[ManagedByLabel] != ManagedByValue {
+		return UnmanagedSecretError{msg: fmt.Sprintf(`The configmap %s/%s was not created by the kubernetes.secrets plugin `+
+			`and will not be replaced. Only configmaps labeled %s=%s may be replaced by the plugin`,
+			namespace, cm.Name, ManagedByLabel, ManagedByValue)}
+	}
+
+	if existing.Immutable == nil || !*existing.Immutable {
+		updated := existing.DeepCopy()
+		updated.Data = cm.Data
+		updated.BinaryData = nil
+		updated.Labels = cm.Labels
+		updated.Annotations = cm.Annotations
+		updated.Immutable = cm.Immutable
+		if _, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+			return s.clientSet.CoreV1().ConfigMaps(namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		}); err != nil {
+			return fmt.Errorf("could not replace configmap %s/%s: %w", namespace, cm.Name, err)
+		}
+		return nil
+	}
+
+	preconditions := metav1.Preconditions{UID: &existing.UID}
+	err = s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+		return s.clientSet.CoreV1().ConfigMaps(namespace).Delete(ctx, cm.Name, metav1.DeleteOptions{Preconditions: &preconditions})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete configmap %s/%s to replace it: %w", namespace, cm.Name, err)
+	}
+	if _, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(namespace).Create(ctx, cm, metav1.CreateOptions{})
+	}); err != nil {
+		return fmt.Errorf("could not recreate configmap %s/%s: %w", namespace, cm.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newConfigMap(name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace}, Data: data}
+}
+
+func TestStore_ConfigMap(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("resolve", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{},
+			newConfigMap("region", map[string]string{CredentialDataKey: "eastus"}),
+			newConfigMap("endpoints", map[string]string{"api": "https://example.com"}))
+
+		got, err := s.Resolve(ctx, ConfigMapSourceType, "region")
+		require.NoError(t, err)
+		require.Equal(t, "eastus", got, "the fallback data keys should be used")
+
+		got, err = s.Resolve(ctx, ConfigMapSourceType, "endpoints#api")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", got)
+
+		_, err = s.Resolve(ctx, ConfigMapSourceType, "endpoints")
+		require.ErrorAs(t, err, &InvalidSecretDataKeyError{})
+	})
+
+	t.Run("create", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyIdempotent})
+		require.NoError(t, s.Create(ctx, ConfigMapSourceType, "My_Region", "eastus"))
+		require.NoError(t, s.Create(ctx, ConfigMapSourceType, "My_Region", "eastus"))
+		require.EqualError(t, s.Create(ctx, ConfigMapSourceType, "My_Region", "westus"),
+			"configmap porter/my-region-855048873b already exists with a different value")
+
+		cm, err := s.clientSet.CoreV1().ConfigMaps(testNamespace).Get(ctx, KubernetesName("My_Region"), metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, ManagedByValue, cm.Labels[ManagedByLabel])
+		require.Equal(t, "My_Region", cm.Annotations[KeyAnnotation])
+		require.True(t, *cm.Immutable)
+
+		got, err := s.Resolve(ctx, ConfigMapSourceType, "My_Region")
+		require.NoError(t, err)
+		require.Equal(t, "eastus", got)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "My_Region")
+		require.Error(t, err, "configmaps should not be resolved as secrets")
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace})
+		require.NoError(t, s.Create(ctx, ConfigMapSourceType, "region", "eastus"))
+		require.NoError(t, s.Create(ctx, ConfigMapSourceType, "region", "westus"))
+
+		got, err := s.Resolve(ctx, ConfigMapSourceType, "region")
+		require.NoError(t, err)
+		require.Equal(t, "westus", got)
+	})
+}
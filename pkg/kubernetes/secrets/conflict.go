@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConflictPolicyFail returns an error when the secret already exists.
+	ConflictPolicyFail = "fail"
+
+	// ConflictPolicyIdempotent succeeds when the existing secret holds the
+	// same value, and fails otherwise.
+	ConflictPolicyIdempotent = "idempotent"
+
+	// ConflictPolicyReplace replaces the existing secret with the new value.
+	ConflictPolicyReplace = "replace"
+)
+
+func validateConflictPolicy(policy string) error {
+	switch policy {
+	case "", ConflictPolicyFail, ConflictPolicyIdempotent, ConflictPolicyReplace:
+		return nil
+	default:
+		return fmt.Errorf("invalid conflictPolicy %q, allowed values are: %s, %s, %s",
+			policy, ConflictPolicyFail, ConflictPolicyIdempotent, ConflictPolicyReplace)
+	}
+}
+
+// handleConflict applies the idempotent or replace conflict policy after
+// Create found that the secret already exists. It returns the secret that
+// is stored when it succeeds, and whether it was replaced. The existing
+// value is decoded before it is compared with the value being created,
+// because encrypted values differ every time they are stored.
+func (s *Store) handleConflict(ctx context.Context, namespace string, secret *v1.Secret, dataKey string, value []byte) (*v1.Secret, bool, error) {
+	s.logger.Debug(fmt.Sprintf("Store.handleConflict: ns:%s, name:%s, policy:%s", namespace, secret.Name, s.conflictPolicy))
+
+	existing, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("could not get existing secret %s/%s: %w", namespace, secret.Name, err)
+	}
+	if err := checkKey("secret", namespace, existing, secret.Annotations[KeyAnnotation]); err != nil {
+		return nil, false, err
+	}
+
+	// A value that can't be read, for example with a key that is no longer configured, is treated as different
+	existingValue, ok, err := s.readValue(ctx, namespace, existing, []string{dataKey})
+	if err == nil && ok && bytes.Equal(existingValue, value) {
+		return existing, false, nil
+	}
+	if s.conflictPolicy == ConflictPolicyIdempotent {
+		return nil, false, fmt.Errorf("secret %s/%s already exists with a different value", namespace, secret.Name)
+	}
+
+	if existing.Labels[ManagedByLabel] != ManagedByValue {
+		return nil, false, UnmanagedSecretError{msg: fmt.Sprintf(`The secret %s/%s was not created by the kubernetes.secrets plugin `+
+			`and will not be replaced. Only secrets labeled %s=%s may be replaced by the plugin`,
+			namespace, secret.Name, ManagedByLabel, ManagedByValue)}
+	}
+
+	stored, err := s.replaceSecret(ctx, namespace, existing, secret)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The chunks of a large value are only removed once the replacement no longer lists them
+	if err := s.deleteChunks(ctx, namespace, existing, stored); err != nil {
+		return nil, false, err
+	}
+	return stored, true, nil
+}
+
+// replaceSecret replaces an existing secret with a new one.
+func (s *Store) replaceSecret(ctx context.Context, namespace string, existing *v1.Secret, secret *v1.Secret) (*v1.Secret, error) {
+	// Mutable secrets are updated in place, which avoids a window where the secret doesn't exist
+	if existing.Immutable == nil || !*existing.Immutable {
+		updated := existing.DeepCopy()
+		updated.Data = secret.Data
+		updated.Labels = secret.Labels
+		updated.Annotations = secret.Annotations
+		updated.Immutable = secret.Immutable
+		stored, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+			return s.clientSet.CoreV1().Secrets(namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not replace secret %s/%s: %w", namespace, secret.Name, err)
+		}
+		return stored, nil
+	}
+
+	// Immutable secrets can't be updated, so delete the secret we read and create it again.
+	// Its chunks are orphaned rather than garbage collected, because the replacement may reuse them.
+	preconditions := metav1.Preconditions{UID: &existing.UID}
+	orphan := metav1.DeletePropagationOrphan
+	err := s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+		return s.clientSet.CoreV1().Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{Preconditions: &preconditions, PropagationPolicy: &orphan})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not delete secret %s/%s to replace it: %w", namespace, secret.Name, err)
+	}
+	stored, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not recreate secret %s/%s: %w", namespace, secret.Name, err)
+	}
+	return stored, nil
+}
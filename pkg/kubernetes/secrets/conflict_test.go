@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStore_Create_ConflictPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fail", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"))
+
+		err := s.Create(ctx, SecretSourceType, "output", "a")
+		require.True(t, apierrors.IsAlreadyExists(err), "expected an AlreadyExists error, got %v", err)
+	})
+
+	t.Run("idempotent", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyIdempotent})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"))
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"), "creating the same value again should succeed")
+
+		err := s.Create(ctx, SecretSourceType, "output", "b")
+		require.EqualError(t, err, "secret porter/output already exists with a different value")
+	})
+
+	t.Run("replace immutable secret", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"))
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "b"))
+		got, err := s.Resolve(ctx, SecretSourceType, "output")
+		require.NoError(t, err)
+		require.Equal(t, "b", got)
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "output", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.True(t, *secret.Immutable)
+	})
+
+	t.Run("replace mutable secret", func(t *testing.T) {
+		immutable := false
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace, Immutable: &immutable})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"))
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "b"))
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "output", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.False(t, *secret.Immutable)
+		require.Equal(t, "b", string(secret.Data[SecretDataKey]))
+	})
+
+	t.Run("replace refuses secrets not created by the plugin", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace}, newSecret("output", map[string]string{SecretDataKey: "a"}))
+
+		err := s.Create(ctx, SecretSourceType, "output", "b")
+		require.ErrorAs(t, err, &UnmanagedSecretError{})
+	})
+}
+
+func TestValidateConflictPolicy(t *testing.T) {
+	require.NoError(t, validateConflictPolicy(""))
+	require.NoError(t, validateConflictPolicy(ConflictPolicyReplace))
+	require.EqualError(t, validateConflictPolicy("overwrite"), `invalid conflictPolicy "overwrite", allowed values are: fail, idempotent, replace`)
+}
@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"get.porter.sh/plugin/kubernetes/pkg"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStore_Create_Metadata(t *testing.T) {
+	ctx := context.Background()
+	origVersion := pkg.Version
+	defer func() { pkg.Version = origVersion }()
+	pkg.Version = "v1.2.3"
+
+	s := newTestStore(t, PluginConfig{
+		Labels:      map[string]string{"team": "platform", ManagedByLabel: "someone-else"},
+		Annotations: map[string]string{"owner": "platform@example.com"},
+	})
+	require.NoError(t, s.Create(ctx, SecretSourceType, "My_Output", "test"))
+
+	list, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	secret := list.Items[0]
+	require.Equal(t, map[string]string{
+		"team":         "platform",
+		ManagedByLabel: ManagedByValue,
+		CreatedByLabel: CreatedByValue,
+		VersionLabel:   "v1.2.3",
+	}, secret.Labels, "the configured labels should not override the plugin's labels")
+	require.Equal(t, map[string]string{
+		"owner":       "platform@example.com",
+		KeyAnnotation: "My_Output",
+	}, secret.Annotations)
+}
+
+func TestValidateMetadata(t *testing.T) {
+	require.NoError(t, validateMetadata(map[string]string{"example.com/team": "platform"}, map[string]string{"owner": "any value is allowed"}))
+	require.ErrorContains(t, validateMetadata(map[string]string{"team": "not a valid value"}, nil), `invalid value for label "team"`)
+	require.ErrorContains(t, validateMetadata(nil, map[string]string{"not valid": ""}), `invalid annotation "not valid"`)
+}
@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStore_Delete(t *testing.T) {
+	ctx := context.Background()
+	unmanaged := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: testNamespace}}
+	s := newTestStore(t, PluginConfig{}, unmanaged)
+
+	t.Run("delete a secret created by the plugin", func(t *testing.T) {
+		require.NoError(t, s.Create(ctx, SecretSourceType, "My_Output", "value"))
+
+		require.NoError(t, s.Delete(ctx, SecretSourceType, "My_Output"))
+
+		list, err := s.clientSet.CoreV1().Secrets(testNamespace).List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1, "expected only the unmanaged secret to remain")
+		require.Equal(t, "unmanaged", list.Items[0].Name)
+	})
+
+	t.Run("deleting a missing secret succeeds", func(t *testing.T) {
+		require.NoError(t, s.Delete(ctx, SecretSourceType, "My_Output"))
+	})
+
+	t.Run("refuse to delete a secret not created by the plugin", func(t *testing.T) {
+		err := s.Delete(ctx, SecretSourceType, "unmanaged")
+		require.ErrorAs(t, err, &UnmanagedSecretError{})
+
+		_, err = s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "unmanaged", metav1.GetOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("unsupported source type", func(t *testing.T) {
+		err := s.Delete(ctx, "env", "HOME")
+		require.EqualError(t, err, "unsupported secret type: env. Only secret is supported")
+	})
+}
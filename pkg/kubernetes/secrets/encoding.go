@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EncodingAnnotation lists the encodings applied to a stored value, in the
+	// order that they were applied. Values without the annotation are stored
+	// as plain data.
+	EncodingAnnotation = "secrets.porter.sh/encoding"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	// MaxDecompressedSize is the largest value that a compressed value may
+	// expand to when it is read, so that a small secret can't exhaust the
+	// memory of the plugin.
+	MaxDecompressedSize = 64 * 1024 * 1024
+)
+
+// The zstd encoder and decoder are expensive to create and safe for
+// concurrent use with EncodeAll and DecodeAll, so they are created on first
+// use and shared.
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+)
+
+func getZstdEncoder() (*zstd.Encoder, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdEncoderErr
+}
+
+func getZstdDecoder() (*zstd.Decoder, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+	})
+	return zstdDecoder, zstdDecoderErr
+}
+
+func validateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression %q, allowed values are: %s, %s, %s",
+			compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// encodeValue applies the configured encodings to a value before it is
+// stored in the named secret, and returns the annotations that record them.
+func (s *Store) encodeValue(ctx context.Context, name string, value []byte) ([]byte, map[string]string, error) {
+	annotations := make(map[string]string)
+	var encodings []string
+
+	if s.compression != "" && s.compression != CompressionNone {
+		compressed, err := compress(s.compression, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Small or random values can grow when compressed, so only use the compressed value when it is smaller
+		if len(compressed) < len(value) {
+			value = compressed
+			encodings = append(encodings, s.compression)
+		}
+	}
+
+	// Encryption is applied last, because encrypted values don't compress
+	if s.encryption.provider() != "" {
+		encrypted, keyAnnotations, err := s.encrypt(ctx, name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		value = encrypted
+		encodings = append(encodings, EncodingAESGCM)
+		for k, v := range keyAnnotations {
+			annotations[k] = v
+		}
+	}
+
+	if len(encodings) > 0 {
+		annotations[EncodingAnnotation] = strings.Join(encodings, ",")
+	}
+	return value, annotations, nil
+}
+
+// decodeValue reverses the encodings listed in the secret's EncodingAnnotation.
+func (s *Store) decodeValue(ctx context.Context, namespace string, secret *v1.Secret, value []byte) ([]byte, error) {
+	annotation := secret.Annotations[EncodingAnnotation]
+	if annotation == "" {
+		return value, nil
+	}
+
+	encodings := strings.Split(annotation, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch encoding := strings.TrimSpace(encodings[i]); encoding {
+		case CompressionGzip, CompressionZstd:
+			value, err = decompress(encoding, value, s.maxDecompressedSize)
+		case EncodingAESGCM:
+			value, err = s.decrypt(ctx, secret, value)
+		default:
+			err = fmt.Errorf("unsupported encoding %q", encoding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode the value of secret %s/%s: %w", namespace, secret.Name, err)
+		}
+	}
+	return value, nil
+}
+
+func compress(algorithm string, value []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(value); err != nil {
+			return nil, fmt.Errorf("could not compress value with gzip: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("could not compress value with gzip: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, err := getZstdEncoder()
+		if err != nil {
+			return nil, fmt.Errorf("could not compress value with zstd: %w", err)
+		}
+		return encoder.EncodeAll(value, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+// decompress returns the decompressed value, or an error when it is larger than limit bytes.
+func decompress(algorithm string, value []byte, limit int) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress gzip value: %w", err)
+		}
+		defer r.Close()
+		result, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress gzip value: %w", err)
+		}
+		if len(result) > limit {
+			return nil, fmt.Errorf("could not decompress gzip value: the value is larger than %d bytes", limit)
+		}
+		return result, nil
+	case CompressionZstd:
+		decoder, err := getZstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress zstd value: %w", err)
+		}
+		// The decoder never allocates more than MaxDecompressedSize
+		result, err := decoder.DecodeAll(value, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || len(result) > limit {
+			return nil, fmt.Errorf("could not decompress zstd value: the value is larger than %d bytes", limit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress zstd value: %w", err)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
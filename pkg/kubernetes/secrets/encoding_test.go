@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStore_Compression(t *testing.T) {
+	ctx := context.Background()
+	value := strings.Repeat(`{"name": "porter"}`, 100)
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			s := newTestStore(t, PluginConfig{Compression: compression})
+			require.NoError(t, s.Create(ctx, SecretSourceType, "output", value))
+
+			secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "output", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, compression, secret.Annotations[EncodingAnnotation])
+			require.Less(t, len(secret.Data[SecretDataKey]), len(value))
+
+			got, err := s.Resolve(ctx, SecretSourceType, "output")
+			require.NoError(t, err)
+			require.Equal(t, value, got)
+		})
+	}
+
+	t.Run("values that don't shrink are stored as plain data", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Compression: CompressionGzip})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "a"))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "output", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.NotContains(t, secret.Annotations, EncodingAnnotation)
+		require.Equal(t, "a", string(secret.Data[SecretDataKey]))
+	})
+
+	t.Run("plain values are read when compression is enabled", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Compression: CompressionGzip}, newSecret("plain", map[string]string{SecretDataKey: value}))
+
+		got, err := s.Resolve(ctx, SecretSourceType, "plain")
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+
+	t.Run("compressed chunks", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{Compression: CompressionGzip})
+		s.chunkSize = 16
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", value))
+
+		got, err := s.Resolve(ctx, SecretSourceType, "output")
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+
+	t.Run("values that expand beyond the limit are rejected", func(t *testing.T) {
+		for _, compression := range []string{CompressionGzip, CompressionZstd} {
+			s := newTestStore(t, PluginConfig{Compression: compression})
+			require.NoError(t, s.Create(ctx, SecretSourceType, "output", value))
+			s.maxDecompressedSize = len(value) - 1
+
+			_, err := s.Resolve(ctx, SecretSourceType, "output")
+			require.ErrorContains(t, err, fmt.Sprintf("the value is larger than %d bytes", len(value)-1), compression)
+		}
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		secret := newSecret("unknown", map[string]string{SecretDataKey: value})
+		secret.Annotations = map[string]string{EncodingAnnotation: "brotli"}
+		s := newTestStore(t, PluginConfig{}, secret)
+
+		_, err := s.Resolve(ctx, SecretSourceType, "unknown")
+		require.EqualError(t, err, `could not decode the value of secret porter/unknown: unsupported encoding "brotli"`)
+	})
+}
@@ -0,0 +1,447 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// EncodingAESGCM is listed in the EncodingAnnotation of values that are
+	// encrypted with a data key, using AES-256 in GCM mode.
+	EncodingAESGCM = "aes-256-gcm"
+
+	// KeyProviderAnnotation records the provider of the key-encryption key
+	// that wrapped the data key of an encrypted value: file, secret or kms.
+	KeyProviderAnnotation = "secrets.porter.sh/key-provider"
+
+	// KeyIDAnnotation records the id of the key-encryption key that wrapped
+	// the data key of an encrypted value.
+	KeyIDAnnotation = "secrets.porter.sh/key-id"
+
+	// WrappedKeyAnnotation holds the base64 encoded data key of an encrypted
+	// value, wrapped by the key-encryption key. The data key is kept in the
+	// metadata so that it can be re-wrapped without changing the data, which
+	// may be immutable.
+	WrappedKeyAnnotation = "secrets.porter.sh/wrapped-key"
+
+	// KeyringDataKey is the default data key of a secret that holds a keyring.
+	KeyringDataKey = "keyring"
+
+	KeyProviderFile   = "file"
+	KeyProviderSecret = "secret"
+	KeyProviderKMS    = "kms"
+
+	// dataKeySize is the size of the AES-256 data keys, and of the keys in a keyring.
+	dataKeySize = 32
+)
+
+// EncryptionConfig selects the key-encryption key used to wrap the data keys
+// of encrypted values. At most one of the settings may be used, and values
+// are stored unencrypted when none are set.
+type EncryptionConfig struct {
+	// KeyFile is the path to a keyring file.
+	KeyFile string `mapstructure:"keyFile"`
+
+	// KeySecret references a Kubernetes secret that holds a keyring, in the
+	// form [NAMESPACE/]NAME[#KEY]. The keyring is read from the "keyring" data
+	// key by default.
+	KeySecret string `mapstructure:"keySecret"`
+
+	// KMSEndpoint is the gRPC endpoint of a Kubernetes KMS v2 plugin, such as
+	// unix:///var/run/kmsplugin/socket.sock.
+	KMSEndpoint string `mapstructure:"kmsEndpoint"`
+
+	// Previous is the key provider that values were encrypted with before
+	// the provider was changed, such as a keyring before moving to a KMS.
+	// It is only used to read values, until they are rewrapped.
+	Previous *EncryptionConfig `mapstructure:"previous"`
+}
+
+// provider returns the name of the configured key provider, or an empty
+// string when encryption is disabled.
+func (c EncryptionConfig) provider() string {
+	switch {
+	case c.KeyFile != "":
+		return KeyProviderFile
+	case c.KeySecret != "":
+		return KeyProviderSecret
+	case c.KMSEndpoint != "":
+		return KeyProviderKMS
+	default:
+		return ""
+	}
+}
+
+func validateEncryption(cfg EncryptionConfig) error {
+	if err := validateKeyProvider(cfg); err != nil {
+		return err
+	}
+	if prev := cfg.Previous; prev != nil {
+		if err := validateKeyProvider(*prev); err != nil {
+			return fmt.Errorf("invalid previous encryption config: %w", err)
+		}
+		switch {
+		case cfg.provider() == "":
+			return fmt.Errorf("invalid encryption config: previous may only be set with keyFile, keySecret or kmsEndpoint")
+		case prev.provider() == "" || prev.Previous != nil:
+			return fmt.Errorf("invalid previous encryption config: one of keyFile, keySecret or kmsEndpoint must be set, and previous may not be nested")
+		case prev.provider() == cfg.provider():
+			return fmt.Errorf("invalid previous encryption config: it uses the same %s key provider as the current config, add the previous keys to the keyring instead", prev.provider())
+		}
+	}
+	return nil
+}
+
+func validateKeyProvider(cfg EncryptionConfig) error {
+	var set []string
+	if cfg.KeyFile != "" {
+		set = append(set, "keyFile")
+	}
+	if cfg.KeySecret != "" {
+		set = append(set, "keySecret")
+		if _, err := ParseReference(cfg.KeySecret); err != nil {
+			return fmt.Errorf("invalid encryption keySecret: %w", err)
+		}
+	}
+	if cfg.KMSEndpoint != "" {
+		set = append(set, "kmsEndpoint")
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("invalid encryption config: only one of keyFile, keySecret or kmsEndpoint may be set, found %s", strings.Join(set, ", "))
+	}
+	return nil
+}
+
+// keyProvider wraps and unwraps data keys with a key-encryption key.
+type keyProvider interface {
+	// wrapKey encrypts a data key with the current key-encryption key, and
+	// returns the id of that key.
+	wrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+
+	// unwrapKey decrypts a data key with the key-encryption key that wrapped it.
+	unwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, error)
+}
+
+// loadKeys returns the configured key provider, creating it on first use.
+func (s *Store) loadKeys(ctx context.Context) (keyProvider, error) {
+	// Cluster profiles use the keys of the default cluster
+	if s.parent != nil {
+		return s.parent.loadKeys(ctx)
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if s.keys == nil {
+		keys, err := s.newKeyProvider(ctx, s.encryption)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = keys
+	}
+	return s.keys, nil
+}
+
+// loadPreviousKeys returns the previous key provider, creating it on first use.
+func (s *Store) loadPreviousKeys(ctx context.Context) (keyProvider, error) {
+	if s.parent != nil {
+		return s.parent.loadPreviousKeys(ctx)
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if s.previousKeys == nil {
+		keys, err := s.newKeyProvider(ctx, *s.encryption.Previous)
+		if err != nil {
+			return nil, err
+		}
+		s.previousKeys = keys
+	}
+	return s.previousKeys, nil
+}
+
+// keysFor returns the key provider that wrapped the data key of a value,
+// which is the configured provider or the previous one.
+func (s *Store) keysFor(ctx context.Context, provider string) (keyProvider, error) {
+	if provider == s.encryption.provider() {
+		return s.loadKeys(ctx)
+	}
+	if prev := s.encryption.Previous; prev != nil && provider == prev.provider() {
+		return s.loadPreviousKeys(ctx)
+	}
+	configured := s.encryption.provider()
+	if configured == "" {
+		configured = "none"
+	}
+	return nil, fmt.Errorf("the value was encrypted with the %s key provider but the configured key provider is %s", provider, configured)
+}
+
+func (s *Store) newKeyProvider(ctx context.Context, cfg EncryptionConfig) (keyProvider, error) {
+	switch cfg.provider() {
+	case KeyProviderFile:
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the encryption keyFile: %w", err)
+		}
+		kr, err := parseKeyring(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption keyFile %s: %w", cfg.KeyFile, err)
+		}
+		return kr, nil
+	case KeyProviderSecret:
+		return s.loadKeyringSecret(ctx, cfg.KeySecret)
+	case KeyProviderKMS:
+		return newKMSProvider(cfg.KMSEndpoint), nil
+	default:
+		return nil, fmt.Errorf("no encryption key is configured, set keyFile, keySecret or kmsEndpoint in the encryption plugin config")
+	}
+}
+
+func (s *Store) loadKeyringSecret(ctx context.Context, keySecret string) (*keyring, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	ref, err := ParseReference(keySecret)
+	if err != nil {
+		return nil, err
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keySecret); err != nil {
+		return nil, err
+	}
+	dataKey := ref.Key
+	if dataKey == "" {
+		dataKey = KeyringDataKey
+	}
+
+	secret, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the encryption keySecret %s in namespace %s: %w", ref.Name, namespace, err)
+	}
+	data, ok := secret.Data[dataKey]
+	if !ok {
+		return nil, fmt.Errorf("the encryption keySecret %s/%s does not have a key named %s", namespace, ref.Name, dataKey)
+	}
+	kr, err := parseKeyring(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption keySecret %s/%s: %w", namespace, ref.Name, err)
+	}
+	return kr, nil
+}
+
+// keyring is a set of key-encryption keys. New data keys are wrapped with
+// the primary key, and the other keys are kept so that values wrapped before
+// a rotation can still be read.
+type keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// parseKeyring reads a keyring with one key per line, in the form
+// ID=BASE64KEY. The first key is the primary key. Blank lines and lines
+// starting with # are ignored.
+func parseKeyring(data []byte) (*keyring, error) {
+	kr := &keyring{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(text, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("line %d: expected a key in the form ID=BASE64KEY", line)
+		}
+		if errs := validation.IsConfigMapKey(id); len(errs) > 0 {
+			return nil, fmt.Errorf("line %d: invalid key id %q: %s", line, id, strings.Join(errs, ", "))
+		}
+		if _, ok := kr.keys[id]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key id %q", line, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key %q is not valid base64: %w", line, id, err)
+		}
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("line %d: key %q must be %d bytes, found %d", line, id, dataKeySize, len(key))
+		}
+
+		if kr.primary == "" {
+			kr.primary = id
+		}
+		kr.keys[id] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if kr.primary == "" {
+		return nil, fmt.Errorf("the keyring does not contain any keys")
+	}
+	return kr, nil
+}
+
+func (k *keyring) wrapKey(_ context.Context, dataKey []byte) ([]byte, string, error) {
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	return wrapped, k.primary, err
+}
+
+func (k *keyring) unwrapKey(_ context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("the keyring does not contain the key %q", keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
+
+// seal encrypts a value with AES-GCM, and returns the nonce followed by the ciphertext.
+func seal(key []byte, value []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, value, additionalData), nil
+}
+
+// open decrypts a value returned by seal.
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals a value with a new data key, and returns the annotations
+// that record the wrapped data key. The value is bound to the name of the
+// secret, so that it can't be swapped with the value of another secret.
+func (s *Store) encrypt(ctx context.Context, name string, value []byte) ([]byte, map[string]string, error) {
+	keys, err := s.loadKeys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("could not generate a data key: %w", err)
+	}
+	sealed, err := seal(dataKey, value, []byte(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not encrypt value: %w", err)
+	}
+	wrapped, keyID, err := keys.wrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not wrap the data key with the %s key provider: %w", s.encryption.provider(), err)
+	}
+
+	annotations := map[string]string{
+		KeyProviderAnnotation: s.encryption.provider(),
+		KeyIDAnnotation:       keyID,
+		WrappedKeyAnnotation:  base64.StdEncoding.EncodeToString(wrapped),
+	}
+	return sealed, annotations, nil
+}
+
+// decrypt opens a value sealed by encrypt.
+func (s *Store) decrypt(ctx context.Context, secret *v1.Secret, value []byte) ([]byte, error) {
+	dataKey, err := s.unwrapDataKey(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	result, err := open(dataKey, value, []byte(secret.Name))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt value: %w", err)
+	}
+	return result, nil
+}
+
+// unwrapDataKey returns the data key recorded in the annotations of an
+// encrypted secret, with the key provider that wrapped it.
+func (s *Store) unwrapDataKey(ctx context.Context, secret *v1.Secret) ([]byte, error) {
+	provider := secret.Annotations[KeyProviderAnnotation]
+	keys, err := s.keysFor(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(secret.Annotations[WrappedKeyAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("the %s annotation is not valid base64: %w", WrappedKeyAnnotation, err)
+	}
+	dataKey, err := keys.unwrapKey(ctx, wrapped, secret.Annotations[KeyIDAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap the data key with the %s key provider: %w", provider, err)
+	}
+	return dataKey, nil
+}
+
+// isEncrypted determines if the value of a secret has a wrapped data key.
+func isEncrypted(secret *v1.Secret) bool {
+	_, ok := secret.Annotations[WrappedKeyAnnotation]
+	return ok
+}
+
+// rewrap wraps the data key of an encrypted secret with the current
+// key-encryption key, which may belong to a different key provider. Only the
+// annotations are updated, so immutable secrets and the chunks of large
+// values are left as they are.
+func (s *Store) rewrap(ctx context.Context, namespace string, secret *v1.Secret) error {
+	dataKey, err := s.unwrapDataKey(ctx, secret)
+	if err != nil {
+		return fmt.Errorf("could not rewrap secret %s/%s: %w", namespace, secret.Name, err)
+	}
+	keys, err := s.loadKeys(ctx)
+	if err != nil {
+		return err
+	}
+	wrapped, keyID, err := keys.wrapKey(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("could not rewrap secret %s/%s: %w", namespace, secret.Name, err)
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.rewrap: ns:%s, name:%s, from:%s, to:%s", namespace, secret.Name, secret.Annotations[KeyIDAnnotation], keyID))
+
+	updated := secret.DeepCopy()
+	updated.Annotations[KeyProviderAnnotation] = s.encryption.provider()
+	updated.Annotations[KeyIDAnnotation] = keyID
+	updated.Annotations[WrappedKeyAnnotation] = base64.StdEncoding.EncodeToString(wrapped)
+	_, err = k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("could not update secret %s/%s: %w", namespace, secret.Name, err)
+	}
+	s.uncacheSecret(namespace, secret.Name)
+	return nil
+}
@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), dataKeySize)))
+}
+
+func writeKeyring(t *testing.T, keyring string) string {
+	path := filepath.Join(t.TempDir(), "keyring")
+	require.NoError(t, os.WriteFile(path, []byte(keyring), 0600))
+	return path
+}
+
+func TestStore_Encryption(t *testing.T) {
+	ctx := context.Background()
+	value := strings.Repeat(`{"password": "porter"}`, 10)
+
+	t.Run("key file", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeyFile: keyFile}})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, EncodingAESGCM, secret.Annotations[EncodingAnnotation])
+		require.Equal(t, KeyProviderFile, secret.Annotations[KeyProviderAnnotation])
+		require.Equal(t, "k1", secret.Annotations[KeyIDAnnotation])
+		require.NotContains(t, string(secret.Data[SecretDataKey]), "porter", "the value should not be stored in plain text")
+
+		got, err := s.Resolve(ctx, SecretSourceType, "password")
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+
+	t.Run("key secret", func(t *testing.T) {
+		keySecret := newSecret("porter-keys", map[string]string{KeyringDataKey: "k1=" + newTestKey('a')})
+		s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeySecret: "porter-keys"}}, keySecret)
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+
+		got, err := s.Resolve(ctx, SecretSourceType, "password")
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+
+	t.Run("compressed chunks", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newTestStore(t, PluginConfig{Compression: CompressionGzip, Encryption: EncryptionConfig{KeyFile: keyFile}})
+		s.chunkSize = 16
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, CompressionGzip+","+EncodingAESGCM, secret.Annotations[EncodingAnnotation])
+
+		got, err := s.Resolve(ctx, SecretSourceType, "password")
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	})
+
+	t.Run("idempotent create of an encrypted value", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyIdempotent, Encryption: EncryptionConfig{KeyFile: keyFile}})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+		require.Error(t, s.Create(ctx, SecretSourceType, "password", "other"))
+	})
+
+	t.Run("values swapped between secrets are rejected", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeyFile: keyFile}})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+		require.NoError(t, err)
+		annotations := make(map[string]string)
+		for _, k := range []string{EncodingAnnotation, KeyProviderAnnotation, KeyIDAnnotation, WrappedKeyAnnotation} {
+			annotations[k] = secret.Annotations[k]
+		}
+		secret = secret.DeepCopy()
+		secret.ObjectMeta = metav1.ObjectMeta{Name: "other", Namespace: testNamespace, Annotations: annotations}
+		_, err = s.clientSet.CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "other")
+		require.ErrorContains(t, err, "could not decrypt value")
+	})
+
+	t.Run("encrypted values can't be read without the key", func(t *testing.T) {
+		keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+		s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeyFile: keyFile}})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "password", value))
+
+		s.encryption = EncryptionConfig{}
+		s.keys = nil
+		_, err := s.Resolve(ctx, SecretSourceType, "password")
+		require.EqualError(t, err, "could not decode the value of secret porter/password: the value was encrypted with the file key provider but the configured key provider is none")
+	})
+}
+
+func TestStore_Rewrap(t *testing.T) {
+	ctx := context.Background()
+	keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+	s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeyFile: keyFile}})
+	require.NoError(t, s.Create(ctx, SecretSourceType, "password", "secret"))
+	s.chunkSize = 4
+	require.NoError(t, s.Create(ctx, SecretSourceType, "large", "a large value"))
+
+	// Rotate the key, keeping the old key so that existing values can be read
+	require.NoError(t, os.WriteFile(keyFile, []byte("k2="+newTestKey('b')+"\nk1="+newTestKey('a')), 0600))
+	s.keys = nil
+	got, err := s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+
+	count, err := s.RewrapAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	for _, name := range []string{"password", "large"} {
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "k2", secret.Annotations[KeyIDAnnotation])
+	}
+
+	// Remove the old key
+	require.NoError(t, os.WriteFile(keyFile, []byte("k2="+newTestKey('b')), 0600))
+	s.keys = nil
+	got, err = s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+	got, err = s.Resolve(ctx, SecretSourceType, "large")
+	require.NoError(t, err)
+	require.Equal(t, "a large value", got)
+
+	require.NoError(t, s.Rewrap(ctx, SecretSourceType, "password"))
+	require.NoError(t, s.Rewrap(ctx, SecretSourceType, "large"))
+}
+
+func TestParseKeyring(t *testing.T) {
+	kr, err := parseKeyring([]byte("# rotated on 2024-01-01\nk2=" + newTestKey('b') + "\n\nk1=" + newTestKey('a') + "\n"))
+	require.NoError(t, err)
+	require.Equal(t, "k2", kr.primary)
+	require.Len(t, kr.keys, 2)
+
+	_, err = parseKeyring([]byte("# no keys\n"))
+	require.EqualError(t, err, "the keyring does not contain any keys")
+
+	_, err = parseKeyring([]byte("k1=" + base64.StdEncoding.EncodeToString([]byte("short"))))
+	require.EqualError(t, err, `line 1: key "k1" must be 32 bytes, found 5`)
+
+	_, err = parseKeyring([]byte("k1=" + newTestKey('a') + "\nk1=" + newTestKey('b')))
+	require.EqualError(t, err, `line 2: duplicate key id "k1"`)
+}
+
+func TestValidateEncryption(t *testing.T) {
+	require.NoError(t, validateEncryption(EncryptionConfig{}))
+	require.NoError(t, validateEncryption(EncryptionConfig{KeySecret: "porter/keys#keyring"}))
+	require.EqualError(t, validateEncryption(EncryptionConfig{KeyFile: "keyring", KMSEndpoint: "unix:///kms.sock"}),
+		"invalid encryption config: only one of keyFile, keySecret or kmsEndpoint may be set, found keyFile, kmsEndpoint")
+	require.NoError(t, validateEncryption(EncryptionConfig{KMSEndpoint: "unix:///kms.sock", Previous: &EncryptionConfig{KeyFile: "keyring"}}))
+	require.ErrorContains(t, validateEncryption(EncryptionConfig{Previous: &EncryptionConfig{KeyFile: "keyring"}}), "previous may only be set with")
+	require.ErrorContains(t, validateEncryption(EncryptionConfig{KeyFile: "new", Previous: &EncryptionConfig{KeyFile: "old"}}), "add the previous keys to the keyring instead")
+}
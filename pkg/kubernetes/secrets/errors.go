@@ -7,3 +7,67 @@ type InvalidSecretDataKeyError struct {
 func (e InvalidSecretDataKeyError) Error() string {
 	return e.msg
 }
+
+type UnmanagedSecretError struct {
+	msg string
+}
+
+func (e UnmanagedSecretError) Error() string {
+	return e.msg
+}
+
+type ChunkError struct {
+	msg string
+}
+
+func (e ChunkError) Error() string {
+	return e.msg
+}
+
+type KeyCollisionError struct {
+	msg string
+}
+
+func (e KeyCollisionError) Error() string {
+	return e.msg
+}
+
+type HostSourceNotAllowedError struct {
+	msg string
+}
+
+func (e HostSourceNotAllowedError) Error() string {
+	return e.msg
+}
+
+type NamespaceNotAllowedError struct {
+	msg string
+}
+
+func (e NamespaceNotAllowedError) Error() string {
+	return e.msg
+}
+
+type SecretNotExposedError struct {
+	msg string
+}
+
+func (e SecretNotExposedError) Error() string {
+	return e.msg
+}
+
+type ReferenceNotGrantedError struct {
+	msg string
+}
+
+func (e ReferenceNotGrantedError) Error() string {
+	return e.msg
+}
+
+type TokenNotAllowedError struct {
+	msg string
+}
+
+func (e TokenNotAllowedError) Error() string {
+	return e.msg
+}
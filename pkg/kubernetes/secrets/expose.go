@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultExposeValue is the value of the expose label or annotation when
+// ExposeLabel does not specify one.
+const DefaultExposeValue = "true"
+
+// parseExposeLabel parses the ExposeLabel setting, KEY[=VALUE], such as
+// porter.sh/expose=true.
+func parseExposeLabel(exposeLabel string) (key string, value string, err error) {
+	key, value, hasValue := strings.Cut(exposeLabel, "=")
+	if !hasValue {
+		value = DefaultExposeValue
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid exposeLabel %q: %s", exposeLabel, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid value for exposeLabel %q: %s", exposeLabel, strings.Join(errs, ", "))
+	}
+	return key, value, nil
+}
+
+func validateExposeLabel(exposeLabel string) error {
+	if exposeLabel == "" {
+		return nil
+	}
+	_, _, err := parseExposeLabel(exposeLabel)
+	return err
+}
+
+// checkExposed returns a SecretNotExposedError when ExposeLabel is set, and
+// the secret has neither a label nor an annotation with the expected value.
+// The plugin labels the secrets that it creates, the managed-by label is not
+// trusted because anyone who can create a secret can set it.
+func (s *Store) checkExposed(namespace string, secret *v1.Secret) error {
+	if s.exposeKey == "" {
+		return nil
+	}
+	if secret.Labels[s.exposeKey] == s.exposeValue || secret.Annotations[s.exposeKey] == s.exposeValue {
+		return nil
+	}
+	return SecretNotExposedError{msg: fmt.Sprintf("The secret %s/%s is not exposed to Porter. The kubernetes.secrets plugin "+
+		"only resolves secrets with the %s=%s label or annotation, add it to the secret to use it in a parameter or credential set, "+
+		"for example: kubectl label secret %s --namespace %s %s=%s",
+		namespace, secret.Name, s.exposeKey, s.exposeValue, secret.Name, namespace, s.exposeKey, s.exposeValue)}
+}
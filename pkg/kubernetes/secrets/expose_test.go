@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStore_Resolve_Exposed(t *testing.T) {
+	ctx := context.Background()
+
+	labeled := newSecret("labeled", map[string]string{"value": "from label"})
+	labeled.Labels = map[string]string{"porter.sh/expose": "true"}
+	annotated := newSecret("annotated", map[string]string{"value": "from annotation"})
+	annotated.Annotations = map[string]string{"porter.sh/expose": "true"}
+	managed := newSecret("managed", map[string]string{"value": "from porter"})
+	managed.Labels = map[string]string{ManagedByLabel: ManagedByValue}
+	notExposed := newSecret("sa-token", map[string]string{"value": "private"})
+	optedOut := newSecret("opted-out", map[string]string{"value": "private"})
+	optedOut.Labels = map[string]string{"porter.sh/expose": "false"}
+
+	t.Run("every secret is resolved by default", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, notExposed)
+		got, err := s.Resolve(ctx, SecretSourceType, "sa-token")
+		require.NoError(t, err)
+		require.Equal(t, "private", got)
+	})
+
+	t.Run("only exposed secrets are resolved", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ExposeLabel: "porter.sh/expose"}, labeled, annotated, managed, notExposed, optedOut)
+
+		for name, want := range map[string]string{"labeled": "from label", "annotated": "from annotation"} {
+			got, err := s.Resolve(ctx, SecretSourceType, name)
+			require.NoError(t, err, name)
+			require.Equal(t, want, got, name)
+		}
+
+		_, err := s.Resolve(ctx, SecretSourceType, "sa-token")
+		require.ErrorAs(t, err, &SecretNotExposedError{})
+		require.EqualError(t, err, "The secret porter/sa-token is not exposed to Porter. The kubernetes.secrets plugin only resolves "+
+			"secrets with the porter.sh/expose=true label or annotation, add it to the secret to use it in a parameter or credential set, "+
+			"for example: kubectl label secret sa-token --namespace porter porter.sh/expose=true")
+
+		_, err = s.Resolve(ctx, SecretSourceType, "opted-out")
+		require.ErrorAs(t, err, &SecretNotExposedError{})
+
+		// Anyone who can create a secret can set the managed-by label
+		_, err = s.Resolve(ctx, SecretSourceType, "managed")
+		require.ErrorAs(t, err, &SecretNotExposedError{})
+	})
+
+	t.Run("created secrets are exposed", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{ExposeLabel: "porter.sh/expose=yes"})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "db-password", "topsecret"))
+
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "db-password", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "yes", secret.Labels["porter.sh/expose"])
+
+		got, err := s.Resolve(ctx, SecretSourceType, "db-password")
+		require.NoError(t, err)
+		require.Equal(t, "topsecret", got)
+	})
+}
+
+func TestParseExposeLabel(t *testing.T) {
+	key, value, err := parseExposeLabel("example.com/porter=yes")
+	require.NoError(t, err)
+	require.Equal(t, "example.com/porter", key)
+	require.Equal(t, "yes", value)
+
+	key, value, err = parseExposeLabel("porter.sh/expose")
+	require.NoError(t, err)
+	require.Equal(t, "porter.sh/expose", key)
+	require.Equal(t, DefaultExposeValue, value)
+
+	_, _, err = parseExposeLabel("porter expose")
+	require.ErrorContains(t, err, `invalid exposeLabel "porter expose"`)
+}
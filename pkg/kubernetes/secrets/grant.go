@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GrantLabel marks the ConfigMaps in a namespace that grant other
+	// namespaces access to its secrets, in the style of the Gateway API's
+	// ReferenceGrant.
+	GrantLabel = "secrets.porter.sh/grant"
+
+	// GrantNamespacesKey lists the namespaces that a grant applies to.
+	GrantNamespacesKey = "namespaces"
+
+	// GrantSecretsKey lists the secrets that a grant applies to. When a grant
+	// doesn't list any objects, it applies to every secret and configmap in
+	// the namespace.
+	GrantSecretsKey = "secrets"
+
+	// GrantConfigMapsKey lists the configmaps that a grant applies to.
+	GrantConfigMapsKey = "configMaps"
+
+	// GrantServiceAccountsKey lists the service accounts that tokens may be
+	// requested for. When it is missing, no tokens may be requested.
+	GrantServiceAccountsKey = "serviceAccounts"
+
+	// GrantResourcesKey lists the resources, RESOURCE[.GROUP]/NAME such as
+	// services/web, that may be read. When it is missing, no resources may be read.
+	GrantResourcesKey = "resources"
+)
+
+// grantKind is a kind of object that a grant applies to.
+type grantKind struct {
+	// key in the grant that lists the objects.
+	key string
+
+	// action and noun describe the access in errors.
+	action string
+	noun   string
+}
+
+var (
+	secretGrant         = grantKind{key: GrantSecretsKey, action: "use the secret", noun: "secret"}
+	configMapGrant      = grantKind{key: GrantConfigMapsKey, action: "use the configmap", noun: "configmap"}
+	serviceAccountGrant = grantKind{key: GrantServiceAccountsKey, action: "request a token for the service account", noun: "service account"}
+	resourceGrant       = grantKind{key: GrantResourcesKey, action: "read the resource", noun: "resource"}
+)
+
+// grantAllows determines if a grant allows the source namespace to use an
+// object. The lists in a grant are separated by commas or whitespace. A
+// grant that doesn't list any objects applies to every secret and configmap,
+// but service accounts and resources must always be listed.
+func grantAllows(grant v1.ConfigMap, sourceNamespace string, kind grantKind, names ...string) bool {
+	if !containsAny(grant.Data[GrantNamespacesKey], sourceNamespace) {
+		return false
+	}
+	objects, ok := grant.Data[kind.key]
+	if !ok {
+		return (kind == secretGrant || kind == configMapGrant) &&
+			!hasAnyKey(grant, GrantSecretsKey, GrantConfigMapsKey, GrantServiceAccountsKey, GrantResourcesKey)
+	}
+	return containsAny(objects, names...)
+}
+
+func hasAnyKey(grant v1.ConfigMap, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := grant.Data[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list string, values ...string) bool {
+	items := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, item := range items {
+		for _, value := range values {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkGrant returns a ReferenceNotGrantedError when RequireGrants is set,
+// and an object outside the configured namespace is used without a grant in
+// the object's namespace. The grant is checked before the object is read or
+// written, or a token is requested. The first name is used in errors.
+func (s *Store) checkGrant(ctx context.Context, namespace string, kind grantKind, names ...string) error {
+	if !s.requireGrants || namespace == s.namespace {
+		return nil
+	}
+
+	grants, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.ConfigMapList, error) {
+		return s.clientSet.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{LabelSelector: GrantLabel + "=true"})
+	})
+	if err != nil {
+		return fmt.Errorf("could not list the grants in namespace %s: %w", namespace, err)
+	}
+	for _, grant := range grants.Items {
+		if grantAllows(grant, s.namespace, kind, names...) {
+			s.logger.Debug(fmt.Sprintf("Store.checkGrant: %s %s/%s is granted to namespace %s by %s", kind.noun, namespace, names[0], s.namespace, grant.Name))
+			return nil
+		}
+	}
+	return ReferenceNotGrantedError{msg: fmt.Sprintf("The namespace %s is not allowed to %s %s/%s. "+
+		"The kubernetes.secrets plugin requires a ConfigMap in namespace %s labeled %s=true, "+
+		"that lists %s in its %s key and the %s in its %s key",
+		s.namespace, kind.action, namespace, names[0], namespace, GrantLabel, s.namespace, GrantNamespacesKey, kind.noun, kind.key)}
+}
@@ -0,0 +1,162 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newGrant(namespace string, name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{GrantLabel: "true"}},
+		Data:       data,
+	}
+}
+
+func TestStore_Resolve_Grants(t *testing.T) {
+	ctx := context.Background()
+
+	dbCreds := newSecret("db-creds", map[string]string{"value": "db password"})
+	dbCreds.Namespace = "platform"
+	apiKey := newSecret("api-key", map[string]string{"value": "api key"})
+	apiKey.Namespace = "platform"
+	other := newSecret("db-creds", map[string]string{"value": "other password"})
+	other.Namespace = "other-team"
+	local := newSecret("local", map[string]string{"value": "local value"})
+
+	grant := newGrant("platform", "porter-grant", map[string]string{GrantNamespacesKey: "ci, porter", GrantSecretsKey: "db-creds"})
+	unlabeled := newGrant("other-team", "porter-grant", map[string]string{GrantNamespacesKey: "porter"})
+	unlabeled.Labels = nil
+	region := newConfigMap("region", map[string]string{CredentialDataKey: "eastus"})
+	region.Namespace = "platform"
+	endpoints := newConfigMap("endpoints", map[string]string{CredentialDataKey: "https://example.com"})
+	endpoints.Namespace = "platform"
+
+	t.Run("grants are not required by default", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, apiKey)
+		got, err := s.Resolve(ctx, SecretSourceType, "platform/api-key")
+		require.NoError(t, err)
+		require.Equal(t, "api key", got)
+	})
+
+	s := newTestStore(t, PluginConfig{RequireGrants: true, TokenServiceAccounts: []string{"platform/*"}}, dbCreds, apiKey, other, local, grant, unlabeled, region, endpoints,
+		newGrant("platform", "porter-tokens", map[string]string{GrantNamespacesKey: "porter", GrantServiceAccountsKey: "deployer", GrantResourcesKey: "services/web"}),
+		newGrant("platform", "porter-config", map[string]string{GrantNamespacesKey: "porter", GrantConfigMapsKey: "region, zone"}))
+	s.restConfig = &rest.Config{Host: "https://10.0.0.1:6443", TLSClientConfig: rest.TLSClientConfig{CAData: []byte("test-ca")}}
+	s.dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Service", "platform", "web", map[string]any{"spec": map[string]any{"clusterIP": "10.96.0.10"}}),
+		newUnstructured("v1", "Service", "platform", "api", map[string]any{"spec": map[string]any{"clusterIP": "10.96.0.11"}}),
+	)
+	s.clientSet.(*fake.Clientset).PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateActionImpl)
+		result := create.GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+		result.Status.Token = "token-for-" + create.Name
+		return true, result, nil
+	})
+
+	t.Run("granted secret", func(t *testing.T) {
+		got, err := s.Resolve(ctx, SecretSourceType, "platform/db-creds")
+		require.NoError(t, err)
+		require.Equal(t, "db password", got)
+	})
+
+	t.Run("secret in the configured namespace", func(t *testing.T) {
+		got, err := s.Resolve(ctx, SecretSourceType, "local")
+		require.NoError(t, err)
+		require.Equal(t, "local value", got)
+	})
+
+	t.Run("secret not in the grant", func(t *testing.T) {
+		_, err := s.Resolve(ctx, SecretSourceType, "platform/api-key")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+		require.EqualError(t, err, "The namespace porter is not allowed to use the secret platform/api-key. "+
+			"The kubernetes.secrets plugin requires a ConfigMap in namespace platform labeled secrets.porter.sh/grant=true, "+
+			"that lists porter in its namespaces key and the secret in its secrets key")
+	})
+
+	t.Run("writing a secret", func(t *testing.T) {
+		err := s.Create(ctx, SecretSourceType, "platform/api-key", "new key")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+
+		err = s.Delete(ctx, SecretSourceType, "platform/api-key")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+	})
+
+	t.Run("configmaps", func(t *testing.T) {
+		got, err := s.Resolve(ctx, ConfigMapSourceType, "platform/region")
+		require.NoError(t, err)
+		require.Equal(t, "eastus", got)
+
+		_, err = s.Resolve(ctx, ConfigMapSourceType, "platform/endpoints")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+		require.EqualError(t, err, "The namespace porter is not allowed to use the configmap platform/endpoints. "+
+			"The kubernetes.secrets plugin requires a ConfigMap in namespace platform labeled secrets.porter.sh/grant=true, "+
+			"that lists porter in its namespaces key and the configmap in its configMaps key")
+
+		require.NoError(t, s.Create(ctx, ConfigMapSourceType, "platform/zone", "eastus-1"))
+		err = s.Create(ctx, ConfigMapSourceType, "platform/endpoints", "https://example.org")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+	})
+
+	t.Run("grant without the label", func(t *testing.T) {
+		_, err := s.Resolve(ctx, SecretSourceType, "other-team/db-creds")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+	})
+
+	t.Run("service accounts", func(t *testing.T) {
+		got, err := s.Resolve(ctx, ServiceAccountTokenSourceType, "platform/deployer")
+		require.NoError(t, err)
+		require.Equal(t, "token-for-deployer", got)
+
+		_, err = s.Resolve(ctx, ServiceAccountTokenSourceType, "platform/admin")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+		require.ErrorContains(t, err, "The namespace porter is not allowed to request a token for the service account platform/admin")
+
+		_, err = s.Resolve(ctx, KubeconfigSourceType, "platform/deployer")
+		require.NoError(t, err)
+
+		_, err = s.Resolve(ctx, KubeconfigSourceType, "platform/admin")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		got, err := s.Resolve(ctx, ResourceSourceType, "platform/services.v1/web#{.spec.clusterIP}")
+		require.NoError(t, err)
+		require.Equal(t, "10.96.0.10", got)
+
+		_, err = s.Resolve(ctx, ResourceSourceType, "platform/services.v1/api#{.spec.clusterIP}")
+		require.ErrorAs(t, err, &ReferenceNotGrantedError{})
+		require.ErrorContains(t, err, "The namespace porter is not allowed to read the resource platform/services/api")
+	})
+}
+
+func TestGrantAllows(t *testing.T) {
+	allSecrets := *newGrant("platform", "all", map[string]string{GrantNamespacesKey: "ci\nporter"})
+	require.True(t, grantAllows(allSecrets, "porter", secretGrant, "db-creds"))
+	require.False(t, grantAllows(allSecrets, "dev", secretGrant, "db-creds"))
+	require.False(t, grantAllows(allSecrets, "porter", serviceAccountGrant, "deployer"), "service accounts must be listed")
+	require.False(t, grantAllows(allSecrets, "porter", resourceGrant, "services/web"), "resources must be listed")
+	require.True(t, grantAllows(allSecrets, "porter", configMapGrant, "region"))
+
+	tokens := *newGrant("platform", "tokens", map[string]string{GrantNamespacesKey: "porter", GrantServiceAccountsKey: "deployer"})
+	require.True(t, grantAllows(tokens, "porter", serviceAccountGrant, "deployer"))
+	require.False(t, grantAllows(tokens, "porter", secretGrant, "db-creds"), "a grant for service accounts should not grant every secret")
+
+	someSecrets := *newGrant("platform", "some", map[string]string{GrantNamespacesKey: "porter", GrantSecretsKey: "db-creds,api-key"})
+	require.True(t, grantAllows(someSecrets, "porter", secretGrant, "api-key"))
+	require.False(t, grantAllows(someSecrets, "porter", secretGrant, "tls"))
+	require.False(t, grantAllows(someSecrets, "porter", configMapGrant, "region"), "a grant for some secrets should not grant every configmap")
+
+	configMaps := *newGrant("platform", "config", map[string]string{GrantNamespacesKey: "porter", GrantConfigMapsKey: "region"})
+	require.True(t, grantAllows(configMaps, "porter", configMapGrant, "region"))
+	require.False(t, grantAllows(configMaps, "porter", secretGrant, "db-creds"), "a grant for configmaps should not grant every secret")
+}
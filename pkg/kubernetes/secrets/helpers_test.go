@@ -0,0 +1,29 @@
+package secrets
+
+import (
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"github.com/hashicorp/go-hclog"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "porter"
+
+// newTestStore creates a Store that uses a fake clientset populated with the specified objects.
+func newTestStore(t *testing.T, cfg PluginConfig, objects ...runtime.Object) *Store {
+	if cfg.Namespace == "" {
+		cfg.Namespace = testNamespace
+	}
+	cfg.Logger = hclog.New(&hclog.LoggerOptions{
+		Name:   PluginKey,
+		Output: os.Stderr,
+		Level:  hclog.Error,
+	})
+	tc := portercontext.NewTestContext(t)
+	s := NewStore(tc.Context, cfg)
+	s.clientSet = fake.NewSimpleClientset(objects...)
+	return s
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	cnabhost "github.com/cnabio/cnab-go/secrets/host"
+)
+
+// hostSources are the sources resolved from the host running the plugin,
+// which may be restricted with AllowedHostSources. The value source only
+// returns the value from the reference, so it is always allowed.
+var hostSources = []string{cnabhost.SourceEnv, cnabhost.SourcePath, cnabhost.SourceCommand}
+
+// inCluster is replaced in tests.
+var inCluster = k8shelper.InCluster
+
+func validateHostSources(sources []string) error {
+	for _, source := range sources {
+		if !isHostSource(source) {
+			return fmt.Errorf("invalid allowedHostSources %q, allowed values are: %s", source, strings.Join(hostSources, ", "))
+		}
+	}
+	return nil
+}
+
+func isHostSource(source string) bool {
+	for _, hostSource := range hostSources {
+		if source == hostSource {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHostSources returns the host sources that may be resolved. Host
+// sources are disabled by default in a pod, such as the Porter Operator's
+// agent, so that bundles can't read the pod's environment or filesystem.
+func allowedHostSources(configured []string) map[string]bool {
+	if configured == nil {
+		if inCluster() {
+			configured = []string{}
+		} else {
+			configured = hostSources
+		}
+	}
+
+	allowed := make(map[string]bool, len(configured))
+	for _, source := range configured {
+		allowed[source] = true
+	}
+	return allowed
+}
+
+// checkHostSource returns a HostSourceNotAllowedError when a host source is
+// not in AllowedHostSources.
+func (s *Store) checkHostSource(keyName string) error {
+	source := strings.ToLower(keyName)
+	if !isHostSource(source) || s.allowedHostSources[source] {
+		return nil
+	}
+	return HostSourceNotAllowedError{msg: fmt.Sprintf("the %s source is not allowed by the kubernetes.secrets plugin. "+
+		"Add it to allowedHostSources in the plugin config to resolve values from the host running the plugin", source)}
+}
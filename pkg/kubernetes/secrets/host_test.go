@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Resolve_HostSources(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("PORTER_TEST_VALUE", "from env")
+
+	t.Run("host sources don't connect to the cluster", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+		tc := portercontext.NewTestContext(t)
+		s := NewStore(tc.Context, PluginConfig{AllowedHostSources: []string{"env"}, Logger: hclog.NewNullLogger()})
+
+		got, err := s.Resolve(ctx, "env", "PORTER_TEST_VALUE")
+		require.NoError(t, err)
+		require.Equal(t, "from env", got)
+		require.Nil(t, s.clientSet)
+	})
+
+	t.Run("only allowed host sources are resolved", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{AllowedHostSources: []string{"path"}})
+
+		_, err := s.Resolve(ctx, "env", "PORTER_TEST_VALUE")
+		require.ErrorAs(t, err, &HostSourceNotAllowedError{})
+
+		path := filepath.Join(t.TempDir(), "value")
+		require.NoError(t, os.WriteFile(path, []byte("from path"), 0600))
+		got, err := s.Resolve(ctx, "path", path)
+		require.NoError(t, err)
+		require.Equal(t, "from path", got)
+
+		got, err = s.Resolve(ctx, "value", "literal")
+		require.NoError(t, err)
+		require.Equal(t, "literal", got, "the value source should always be allowed")
+	})
+
+	t.Run("host sources are disabled by default in a cluster", func(t *testing.T) {
+		origInCluster := inCluster
+		defer func() { inCluster = origInCluster }()
+
+		inCluster = func() bool { return true }
+		s := newTestStore(t, PluginConfig{})
+		_, err := s.Resolve(ctx, "env", "PORTER_TEST_VALUE")
+		require.ErrorAs(t, err, &HostSourceNotAllowedError{})
+
+		inCluster = func() bool { return false }
+		s = newTestStore(t, PluginConfig{})
+		got, err := s.Resolve(ctx, "env", "PORTER_TEST_VALUE")
+		require.NoError(t, err)
+		require.Equal(t, "from env", got)
+	})
+}
+
+func TestValidateHostSources(t *testing.T) {
+	require.NoError(t, validateHostSources([]string{"env", "path", "command"}))
+	require.EqualError(t, validateHostSources([]string{"secret"}), `invalid allowedHostSources "secret", allowed values are: env, path, command`)
+}
@@ -0,0 +1,243 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	// kmsService is the gRPC service of the Kubernetes KMS v2 API, which is
+	// implemented by the KMS plugins for the major cloud providers and by
+	// local stubs used in development.
+	kmsService = "/v2.KeyManagementService/"
+
+	// kmsTimeout limits each call to the KMS plugin.
+	kmsTimeout = 30 * time.Second
+)
+
+// kmsProvider wraps data keys with a KMS plugin that implements the
+// Kubernetes KMS v2 API. The annotations that a plugin may return from
+// Encrypt are not stored, so plugins that require them are not supported.
+type kmsProvider struct {
+	endpoint string
+
+	connectOnce sync.Once
+	conn        *grpc.ClientConn
+	connectErr  error
+}
+
+func newKMSProvider(endpoint string) *kmsProvider {
+	// Unix sockets are usually configured as a plain path
+	if strings.HasPrefix(endpoint, "/") {
+		endpoint = "unix://" + endpoint
+	}
+	return &kmsProvider{endpoint: endpoint}
+}
+
+func (p *kmsProvider) connect() (*grpc.ClientConn, error) {
+	p.connectOnce.Do(func() {
+		p.conn, p.connectErr = grpc.NewClient(p.endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if p.connectErr != nil {
+			p.connectErr = fmt.Errorf("could not connect to the KMS plugin at %s: %w", p.endpoint, p.connectErr)
+		}
+	})
+	return p.conn, p.connectErr
+}
+
+func (p *kmsProvider) invoke(ctx context.Context, method string, req kmsMessage, resp kmsMessage) error {
+	conn, err := p.connect()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, kmsTimeout)
+	defer cancel()
+	return conn.Invoke(ctx, kmsService+method, req, resp, grpc.ForceCodec(kmsCodec{}))
+}
+
+func (p *kmsProvider) wrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	var resp kmsEncryptResponse
+	err := p.invoke(ctx, "Encrypt", &kmsEncryptRequest{Plaintext: dataKey, UID: string(uuid.NewUUID())}, &resp)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.KeyID == "" {
+		return nil, "", fmt.Errorf("the KMS plugin did not return a key id")
+	}
+	return resp.Ciphertext, resp.KeyID, nil
+}
+
+func (p *kmsProvider) unwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	var resp kmsDecryptResponse
+	err := p.invoke(ctx, "Decrypt", &kmsDecryptRequest{Ciphertext: wrapped, UID: string(uuid.NewUUID()), KeyID: keyID}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// kmsMessage is a message of the KMS v2 API. The messages are encoded by
+// hand, because they only have a few scalar fields, so that the plugin does
+// not depend on the generated code of the Kubernetes KMS API.
+type kmsMessage interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// kmsCodec encodes kmsMessage values in the protobuf wire format.
+type kmsCodec struct{}
+
+func (kmsCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(kmsMessage)
+	if !ok {
+		return nil, fmt.Errorf("unsupported KMS message type %T", v)
+	}
+	return msg.marshal(), nil
+}
+
+func (kmsCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(kmsMessage)
+	if !ok {
+		return fmt.Errorf("unsupported KMS message type %T", v)
+	}
+	return msg.unmarshal(data)
+}
+
+func (kmsCodec) Name() string {
+	return "proto"
+}
+
+type kmsEncryptRequest struct {
+	Plaintext []byte
+	UID       string
+}
+
+func (m *kmsEncryptRequest) marshal() []byte {
+	var b []byte
+	b = appendBytesField(b, 1, m.Plaintext)
+	b = appendBytesField(b, 2, []byte(m.UID))
+	return b
+}
+
+func (m *kmsEncryptRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			m.Plaintext = value
+		case 2:
+			m.UID = string(value)
+		}
+	})
+}
+
+type kmsEncryptResponse struct {
+	Ciphertext []byte
+	KeyID      string
+}
+
+func (m *kmsEncryptResponse) marshal() []byte {
+	var b []byte
+	b = appendBytesField(b, 1, m.Ciphertext)
+	b = appendBytesField(b, 2, []byte(m.KeyID))
+	return b
+}
+
+func (m *kmsEncryptResponse) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			m.Ciphertext = value
+		case 2:
+			m.KeyID = string(value)
+		}
+	})
+}
+
+type kmsDecryptRequest struct {
+	Ciphertext []byte
+	UID        string
+	KeyID      string
+}
+
+func (m *kmsDecryptRequest) marshal() []byte {
+	var b []byte
+	b = appendBytesField(b, 1, m.Ciphertext)
+	b = appendBytesField(b, 2, []byte(m.UID))
+	b = appendBytesField(b, 3, []byte(m.KeyID))
+	return b
+}
+
+func (m *kmsDecryptRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			m.Ciphertext = value
+		case 2:
+			m.UID = string(value)
+		case 3:
+			m.KeyID = string(value)
+		}
+	})
+}
+
+type kmsDecryptResponse struct {
+	Plaintext []byte
+}
+
+func (m *kmsDecryptResponse) marshal() []byte {
+	return appendBytesField(nil, 1, m.Plaintext)
+}
+
+func (m *kmsDecryptResponse) unmarshal(data []byte) error {
+	return consumeFields(data, func(num protowire.Number, value []byte) {
+		if num == 1 {
+			m.Plaintext = value
+		}
+	})
+}
+
+// appendBytesField appends a bytes or string field, omitting empty values
+// like proto3 does.
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// consumeFields calls fn with the value of each length-delimited field in a
+// message. Fields of other types are skipped.
+func consumeFields(data []byte, fn func(num protowire.Number, value []byte)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, append([]byte(nil), value...))
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
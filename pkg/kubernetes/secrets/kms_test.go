@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// stubKMS is a KMS v2 plugin that wraps keys with a keyring.
+type stubKMS struct {
+	keys *keyring
+}
+
+func (k *stubKMS) encrypt(ctx context.Context, req *kmsEncryptRequest) (*kmsEncryptResponse, error) {
+	ciphertext, keyID, err := k.keys.wrapKey(ctx, req.Plaintext)
+	return &kmsEncryptResponse{Ciphertext: ciphertext, KeyID: keyID}, err
+}
+
+func (k *stubKMS) decrypt(ctx context.Context, req *kmsDecryptRequest) (*kmsDecryptResponse, error) {
+	plaintext, err := k.keys.unwrapKey(ctx, req.Ciphertext, req.KeyID)
+	return &kmsDecryptResponse{Plaintext: plaintext}, err
+}
+
+// startStubKMS serves a stubKMS on a unix socket, and returns the endpoint.
+func startStubKMS(t *testing.T, kms *stubKMS) string {
+	socket := filepath.Join(t.TempDir(), "kms.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(grpc.ForceServerCodec(kmsCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "v2.KeyManagementService",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Encrypt",
+				Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+					var req kmsEncryptRequest
+					if err := dec(&req); err != nil {
+						return nil, err
+					}
+					return kms.encrypt(ctx, &req)
+				},
+			},
+			{
+				MethodName: "Decrypt",
+				Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+					var req kmsDecryptRequest
+					if err := dec(&req); err != nil {
+						return nil, err
+					}
+					return kms.decrypt(ctx, &req)
+				},
+			},
+		},
+	}, kms)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return socket
+}
+
+func TestStore_Encryption_KMS(t *testing.T) {
+	ctx := context.Background()
+	kr, err := parseKeyring([]byte("kms-1=" + newTestKey('a')))
+	require.NoError(t, err)
+	kms := &stubKMS{keys: kr}
+	endpoint := startStubKMS(t, kms)
+
+	s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KMSEndpoint: endpoint}})
+	require.NoError(t, s.Create(ctx, SecretSourceType, "password", "secret"))
+
+	secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, KeyProviderKMS, secret.Annotations[KeyProviderAnnotation])
+	require.Equal(t, "kms-1", secret.Annotations[KeyIDAnnotation])
+
+	got, err := s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+
+	// Rotate the key in the KMS and rewrap the secret
+	kms.keys, err = parseKeyring([]byte("kms-2=" + newTestKey('b') + "\nkms-1=" + newTestKey('a')))
+	require.NoError(t, err)
+	require.NoError(t, s.Rewrap(ctx, SecretSourceType, "password"))
+
+	secret, err = s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "kms-2", secret.Annotations[KeyIDAnnotation])
+
+	got, err = s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+}
+
+func TestStore_Rewrap_KeyFileToKMS(t *testing.T) {
+	ctx := context.Background()
+	keyFile := writeKeyring(t, "k1="+newTestKey('a'))
+	s := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KeyFile: keyFile}})
+	require.NoError(t, s.Create(ctx, SecretSourceType, "password", "secret"))
+
+	kr, err := parseKeyring([]byte("kms-1=" + newTestKey('b')))
+	require.NoError(t, err)
+	endpoint := startStubKMS(t, &stubKMS{keys: kr})
+
+	// Move to the KMS, and read the values that were not rewrapped yet with the key file
+	migrating := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KMSEndpoint: endpoint, Previous: &EncryptionConfig{KeyFile: keyFile}}})
+	migrating.clientSet = s.clientSet
+	got, err := migrating.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+
+	count, err := migrating.RewrapAll(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "password", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, KeyProviderKMS, secret.Annotations[KeyProviderAnnotation])
+	require.Equal(t, "kms-1", secret.Annotations[KeyIDAnnotation])
+
+	// The key file is no longer needed
+	migrated := newTestStore(t, PluginConfig{Encryption: EncryptionConfig{KMSEndpoint: endpoint}})
+	migrated.clientSet = s.clientSet
+	got, err = migrated.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+}
+
+func TestKMSMessages(t *testing.T) {
+	req := &kmsDecryptRequest{Ciphertext: []byte{0, 1, 2}, UID: "uid", KeyID: "key"}
+	var got kmsDecryptRequest
+	require.NoError(t, got.unmarshal(req.marshal()))
+	require.Equal(t, *req, got)
+
+	// The annotations map of an EncryptResponse is ignored: {3: {1: "a", 2: "b"}}
+	data := append((&kmsEncryptResponse{Ciphertext: []byte("c"), KeyID: "k"}).marshal(), 0x1a, 0x06, 0x0a, 0x01, 'a', 0x12, 0x01, 'b')
+	var resp kmsEncryptResponse
+	require.NoError(t, resp.unmarshal(data))
+	require.Equal(t, kmsEncryptResponse{Ciphertext: []byte("c"), KeyID: "k"}, resp)
+}
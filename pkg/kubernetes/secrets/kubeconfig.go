@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigSourceType generates a kubeconfig for a service account, with
+// the API server and CA of the cluster that the plugin is connected to, and a
+// short-lived token requested for the service account. The reference has the
+// same form as the serviceaccount-token source.
+const KubeconfigSourceType = "kubeconfig"
+
+// kubeconfigName is the name of the cluster, user and context in generated
+// kubeconfig files.
+const kubeconfigName = "porter"
+
+// resolveKubeconfig generates a kubeconfig for a service account, whose
+// current context uses the service account's namespace.
+func (s *Store) resolveKubeconfig(ctx context.Context, keyValue string) (string, error) {
+	ref, err := parseTokenReference(keyValue)
+	if err != nil {
+		return "", err
+	}
+	if s.restConfig == nil || s.restConfig.Host == "" {
+		return "", fmt.Errorf("could not generate a kubeconfig for service account %s: the address of the API server is unknown", ref.Name)
+	}
+
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = s.restConfig.Host
+	cluster.TLSServerName = s.restConfig.ServerName
+	cluster.InsecureSkipTLSVerify = s.restConfig.Insecure
+	cluster.CertificateAuthorityData = s.restConfig.CAData
+	// In a cluster, the CA is loaded from the service account's ca.crt file
+	if len(cluster.CertificateAuthorityData) == 0 && s.restConfig.CAFile != "" {
+		cluster.CertificateAuthorityData, err = os.ReadFile(s.restConfig.CAFile)
+		if err != nil {
+			return "", fmt.Errorf("could not generate a kubeconfig for service account %s: could not read the cluster's CA: %w", ref.Name, err)
+		}
+	}
+
+	token, err := s.requestToken(ctx, keyValue, ref)
+	if err != nil {
+		return "", err
+	}
+	user := clientcmdapi.NewAuthInfo()
+	user.Token = token
+
+	kubeContext := clientcmdapi.NewContext()
+	kubeContext.Cluster = kubeconfigName
+	kubeContext.AuthInfo = kubeconfigName
+	kubeContext.Namespace = s.tokenNamespace(ref)
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[kubeconfigName] = cluster
+	config.AuthInfos[kubeconfigName] = user
+	config.Contexts[kubeconfigName] = kubeContext
+	config.CurrentContext = kubeconfigName
+
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("could not generate a kubeconfig for service account %s: %w", ref.Name, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newKubeconfigTestStore creates a Store that returns a token for every
+// service account.
+func newKubeconfigTestStore(t *testing.T, restConfig *rest.Config) *Store {
+	s := newTestStore(t, PluginConfig{TokenServiceAccounts: []string{"ci/deployer"}})
+	s.restConfig = restConfig
+	s.clientSet.(*fake.Clientset).PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateActionImpl)
+		result := create.GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+		result.Status.Token = "token-for-" + create.Namespace + "-" + create.Name
+		return true, result, nil
+	})
+	return s
+}
+
+func TestStore_Resolve_Kubeconfig(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ca data", func(t *testing.T) {
+		s := newKubeconfigTestStore(t, &rest.Config{
+			Host:            "https://10.0.0.1:6443",
+			TLSClientConfig: rest.TLSClientConfig{CAData: []byte("test-ca")},
+		})
+
+		got, err := s.Resolve(ctx, KubeconfigSourceType, "ci/deployer")
+		require.NoError(t, err)
+
+		config, err := clientcmd.Load([]byte(got))
+		require.NoError(t, err)
+		require.Equal(t, kubeconfigName, config.CurrentContext)
+		require.Equal(t, "https://10.0.0.1:6443", config.Clusters[kubeconfigName].Server)
+		require.Equal(t, []byte("test-ca"), config.Clusters[kubeconfigName].CertificateAuthorityData)
+		require.Equal(t, "token-for-ci-deployer", config.AuthInfos[kubeconfigName].Token)
+		require.Equal(t, "ci", config.Contexts[kubeconfigName].Namespace)
+	})
+
+	t.Run("ca file", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.crt")
+		require.NoError(t, os.WriteFile(caFile, []byte("in-cluster-ca"), 0600))
+		s := newKubeconfigTestStore(t, &rest.Config{
+			Host:            "https://kubernetes.default.svc",
+			TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+		})
+
+		got, err := s.Resolve(ctx, KubeconfigSourceType, "deployer")
+		require.NoError(t, err)
+
+		config, err := clientcmd.Load([]byte(got))
+		require.NoError(t, err)
+		require.Equal(t, []byte("in-cluster-ca"), config.Clusters[kubeconfigName].CertificateAuthorityData)
+		require.Equal(t, "token-for-porter-deployer", config.AuthInfos[kubeconfigName].Token)
+		require.Equal(t, testNamespace, config.Contexts[kubeconfigName].Namespace)
+	})
+
+	t.Run("unknown server", func(t *testing.T) {
+		s := newKubeconfigTestStore(t, nil)
+
+		_, err := s.Resolve(ctx, KubeconfigSourceType, "deployer")
+		require.EqualError(t, err, "could not generate a kubeconfig for service account deployer: the address of the API server is unknown")
+	})
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// nameHashLength is the number of hex characters of the key's checksum that
+// are appended to names that could not use the key as is.
+const nameHashLength = 10
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// KubernetesName returns the name of the Kubernetes secret that holds the
+// value of a Porter key. Keys that are already valid secret names are used
+// as is. Other keys are converted to a readable name, truncated to fit the
+// 253 character limit, and suffixed with a hash of the original key, so
+// that different keys never share a secret.
+func KubernetesName(key string) string {
+	if len(validation.IsDNS1123Subdomain(key)) == 0 {
+		return key
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+
+	readable := strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(key), "-"), "-")
+	maxLength := validation.DNS1123SubdomainMaxLength - len(hash) - 1
+	if len(readable) > maxLength {
+		readable = strings.TrimRight(readable[:maxLength], "-")
+	}
+	if readable == "" {
+		return hash
+	}
+	return readable + "-" + hash
+}
+
+// getSecret gets the secret that holds the value of a key.
+func (s *Store) getSecret(ctx context.Context, namespace string, ref SecretReference) (*v1.Secret, error) {
+	if secret, ok, err := s.cachedSecretByKey(ctx, namespace, ref); ok {
+		return secret, err
+	}
+	secret, err := getByKey(ctx, s, "secret", namespace, ref, s.clientSet.CoreV1().Secrets(namespace).Get)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheSecret(namespace, secret)
+	return secret, nil
+}
+
+// getByKey gets the object that holds the value of a key. Objects that were
+// named with SanitizeKey, before KubernetesName was used, are found as well.
+// A KeyCollisionError is returned when the object records a different key.
+func getByKey[T metav1.Object](ctx context.Context, s *Store, kind string, namespace string, ref SecretReference,
+	get func(ctx context.Context, name string, opts metav1.GetOptions) (T, error)) (T, error) {
+	getName := func(name string) (T, error) {
+		return k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (T, error) {
+			return get(ctx, name, metav1.GetOptions{})
+		})
+	}
+
+	name := KubernetesName(ref.Name)
+	obj, err := getName(name)
+	if apierrors.IsNotFound(err) {
+		if legacyName := SanitizeKey(ref.Name); legacyName != name {
+			legacy, legacyErr := getName(legacyName)
+			if legacyErr == nil {
+				s.logger.Debug(fmt.Sprintf("Store.getByKey: kind:%s, ns:%s, key:%s, found legacy name:%s", kind, namespace, ref.Name, legacyName))
+				obj, err = legacy, nil
+			} else if !apierrors.IsNotFound(legacyErr) {
+				err = legacyErr
+			}
+		}
+	}
+	if err != nil {
+		var empty T
+		return empty, err
+	}
+
+	if err := checkKey(kind, namespace, obj, ref.Name); err != nil {
+		var empty T
+		return empty, err
+	}
+	return obj, nil
+}
+
+// checkKey returns a KeyCollisionError when an object records that it holds
+// the value of a different key. Objects without the KeyAnnotation, such as
+// those created with kubectl, are accepted.
+func checkKey(kind string, namespace string, obj metav1.Object, key string) error {
+	if existing, ok := obj.GetAnnotations()[KeyAnnotation]; ok && existing != key {
+		return KeyCollisionError{msg: fmt.Sprintf("the %s %s/%s holds the value of the key %q, not %q",
+			kind, namespace, obj.GetName(), existing, key)}
+	}
+	return nil
+}
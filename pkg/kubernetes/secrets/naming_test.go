@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestKubernetesName(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{"valid names are used as is", "db.password", "db.password"},
+		{"invalid characters", "My_Output", "my-output-b593f6d4ac"},
+		{"only invalid characters", "___", "bda251550b"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			got := KubernetesName(tt.input)
+			require.Len(t, validation.IsDNS1123Subdomain(got), 0, "%q is not a valid name", got)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("keys that sanitize to the same name", func(t *testing.T) {
+		names := map[string]bool{}
+		for _, key := range []string{"a_b", "a*b", "A_B", "a-b"} {
+			names[KubernetesName(key)] = true
+		}
+		require.Len(t, names, 4)
+	})
+
+	t.Run("long keys are truncated", func(t *testing.T) {
+		got := KubernetesName(strings.Repeat("A", 300))
+		require.Len(t, got, validation.DNS1123SubdomainMaxLength)
+		require.Len(t, validation.IsDNS1123Subdomain(got), 0)
+		require.NotEqual(t, got, KubernetesName(strings.Repeat("A", 301)))
+	})
+}
+
+func TestStore_Resolve_Naming(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("secrets are named after the key", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "My_Output", "value"))
+
+		_, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, KubernetesName("My_Output"), metav1.GetOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Delete(ctx, SecretSourceType, "My_Output"))
+		_, err = s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, KubernetesName("My_Output"), metav1.GetOptions{})
+		require.True(t, apierrors.IsNotFound(err), "expected the secret to be deleted, got %v", err)
+	})
+
+	t.Run("keys that sanitize to the same name are stored separately", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{})
+		require.NoError(t, s.Create(ctx, SecretSourceType, "a_b", "underscore"))
+		require.NoError(t, s.Create(ctx, SecretSourceType, "a*b", "star"))
+
+		got, err := s.Resolve(ctx, SecretSourceType, "a_b")
+		require.NoError(t, err)
+		require.Equal(t, "underscore", got)
+		got, err = s.Resolve(ctx, SecretSourceType, "a*b")
+		require.NoError(t, err)
+		require.Equal(t, "star", got)
+	})
+
+	t.Run("secrets named by earlier versions are found", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, newSecret(SanitizeKey("My_Output"), map[string]string{SecretDataKey: "legacy"}))
+
+		got, err := s.Resolve(ctx, SecretSourceType, "My_Output")
+		require.NoError(t, err)
+		require.Equal(t, "legacy", got)
+	})
+
+	t.Run("collisions are detected", func(t *testing.T) {
+		legacy := newSecret("a-b", map[string]string{SecretDataKey: "underscore"})
+		legacy.Annotations = map[string]string{KeyAnnotation: "a_b"}
+		s := newTestStore(t, PluginConfig{}, legacy)
+
+		_, err := s.Resolve(ctx, SecretSourceType, "a*b")
+		require.ErrorAs(t, err, &KeyCollisionError{})
+		require.ErrorContains(t, err, `the secret porter/a-b holds the value of the key "a_b", not "a*b"`)
+	})
+
+	t.Run("create refuses to replace the value of another key", func(t *testing.T) {
+		other := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        KubernetesName("a_b"),
+				Namespace:   testNamespace,
+				Labels:      map[string]string{ManagedByLabel: ManagedByValue},
+				Annotations: map[string]string{KeyAnnotation: "someone else"},
+			},
+			Data: map[string][]byte{SecretDataKey: []byte("other")},
+		}
+		s := newTestStore(t, PluginConfig{ConflictPolicy: ConflictPolicyReplace}, other)
+
+		err := s.Create(ctx, SecretSourceType, "a_b", "value")
+		require.ErrorAs(t, err, &KeyCollisionError{})
+	})
+}
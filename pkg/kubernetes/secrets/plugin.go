@@ -2,8 +2,10 @@ package secrets
 
 import (
 	"fmt"
+	"strings"
 
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/config"
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
 	"get.porter.sh/porter/pkg/portercontext"
 	"get.porter.sh/porter/pkg/secrets"
 	"get.porter.sh/porter/pkg/secrets/plugins"
@@ -12,6 +14,7 @@ import (
 	hplugin "github.com/hashicorp/go-plugin"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const PluginKey = plugins.PluginInterface + ".kubernetes.secrets"
@@ -20,7 +23,91 @@ var _ plugins.SecretsProtocol = &Plugin{}
 
 type PluginConfig struct {
 	Namespace string `mapstructure:"namespace"`
-	Logger    hclog.Logger
+
+	// ConnectionConfig selects the cluster and the credentials that the
+	// plugin uses. Defaults to the in-cluster service account or the kubeconfig.
+	k8shelper.ConnectionConfig `mapstructure:",squash"`
+
+	// Clusters are named cluster profiles, that references select with a
+	// CLUSTER: prefix to resolve values from other clusters.
+	Clusters map[string]ClusterProfile `mapstructure:"clusters"`
+
+	// DataKey is the key in the secret's data that holds the value. Defaults to "value".
+	DataKey string `mapstructure:"dataKey"`
+
+	// FallbackDataKeys are tried in order when a secret does not have DataKey.
+	// Defaults to "credential". Set to an empty list to only use DataKey.
+	FallbackDataKeys []string `mapstructure:"fallbackDataKeys"`
+
+	// ConflictPolicy determines what Create does when the secret already
+	// exists: fail, idempotent or replace. Defaults to fail.
+	ConflictPolicy string `mapstructure:"conflictPolicy"`
+
+	// Immutable determines if the secrets created by the plugin are immutable. Defaults to true.
+	Immutable *bool `mapstructure:"immutable"`
+
+	// Labels are added to the secrets created by the plugin.
+	Labels map[string]string `mapstructure:"labels"`
+
+	// Annotations are added to the secrets created by the plugin.
+	Annotations map[string]string `mapstructure:"annotations"`
+
+	// Compression is the algorithm used to compress values written by the
+	// plugin: none, gzip or zstd. Defaults to none.
+	Compression string `mapstructure:"compression"`
+
+	// AllowedHostSources are the host sources that may be resolved: env, path
+	// and command. Defaults to all of them outside a cluster, and to none of
+	// them when running in a pod. Set to an empty list to disable them.
+	AllowedHostSources []string `mapstructure:"allowedHostSources"`
+
+	// TokenAudiences are the audiences of tokens requested by the
+	// serviceaccount-token source. Defaults to the API server's audiences.
+	TokenAudiences []string `mapstructure:"tokenAudiences"`
+
+	// TokenExpiration is the lifetime of tokens requested by the
+	// serviceaccount-token source, such as 30m. Defaults to 1h.
+	TokenExpiration string `mapstructure:"tokenExpiration"`
+
+	// TokenServiceAccounts are the service accounts in other namespaces,
+	// NAMESPACE/NAME, that tokens may be requested for, using the pattern
+	// syntax of path.Match such as ci/*. Tokens may always be requested for
+	// the service accounts in the configured namespace.
+	TokenServiceAccounts []string `mapstructure:"tokenServiceAccounts"`
+
+	// ExposeLabel is a label or annotation, KEY[=VALUE], that secrets must
+	// have to be resolved, such as porter.sh/expose=true. The value defaults
+	// to true. Every secret may be resolved when it is not set.
+	ExposeLabel string `mapstructure:"exposeLabel"`
+
+	// RequireGrants determines if secrets and configmaps in other namespaces
+	// may only be used when a grant ConfigMap in their namespace allows it.
+	// Defaults to false, so that references to other namespaces that worked
+	// before grants were added keep working, limited only by RBAC and Policy.
+	RequireGrants bool `mapstructure:"requireGrants"`
+
+	// Prefetch determines if the secrets in the namespace are listed once, on
+	// first use, and resolved from memory. Secrets that are not found are
+	// still read individually. Defaults to false.
+	Prefetch bool `mapstructure:"prefetch"`
+
+	// PrefetchSelector is a label selector that limits the secrets that
+	// are prefetched, such as porter.sh/expose=true.
+	PrefetchSelector string `mapstructure:"prefetchSelector"`
+
+	// Retry configures the timeout of each API call, and how calls that fail
+	// with a retryable error are retried.
+	Retry k8shelper.RetryConfig `mapstructure:"retry"`
+
+	// Policy restricts the namespaces that the plugin may read from and
+	// write to. Every namespace is allowed by default.
+	Policy NamespacePolicy `mapstructure:"policy"`
+
+	// Encryption configures the key-encryption key used to encrypt values
+	// written by the plugin. Values are not encrypted by default.
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+
+	Logger hclog.Logger
 }
 
 type Plugin struct {
@@ -28,6 +115,16 @@ type Plugin struct {
 }
 
 func NewPlugin(cxt *portercontext.Context, pluginConfig config.Config) (hplugin.Plugin, error) {
+	cfg, err := NewPluginConfig(cxt, pluginConfig)
+	if err != nil {
+		return nil, err
+	}
+	return pluginstore.NewPlugin(cxt, NewStore(cxt, cfg)), nil
+}
+
+// NewPluginConfig decodes the plugin configuration and sets up the logger
+// used by the Store.
+func NewPluginConfig(cxt *portercontext.Context, pluginConfig config.Config) (PluginConfig, error) {
 	logger := hclog.New(&hclog.LoggerOptions{
 		Name:       PluginKey,
 		Output:     cxt.Err,
@@ -37,7 +134,71 @@ func NewPlugin(cxt *portercontext.Context, pluginConfig config.Config) (hplugin.
 	cfg := PluginConfig{Logger: logger, Namespace: pluginConfig.Namespace}
 	logger.Debug(fmt.Sprintf("NewPlugin.Config.Namespace: %s", cfg.Namespace))
 	if err := mapstructure.Decode(pluginConfig, &cfg); err != nil {
-		return nil, errors.Wrapf(err, "error decoding %s plugin config from %#v", PluginKey, pluginConfig)
+		return PluginConfig{}, errors.Wrapf(err, "error decoding %s plugin config from %#v", PluginKey, pluginConfig)
 	}
-	return pluginstore.NewPlugin(cxt, NewStore(cxt, cfg)), nil
+	if err := cfg.Validate(); err != nil {
+		return PluginConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Validate returns an error when the plugin configuration is invalid.
+func (cfg PluginConfig) Validate() error {
+	if err := cfg.ConnectionConfig.Validate(); err != nil {
+		return err
+	}
+	if err := validatePrefetchSelector(cfg.PrefetchSelector); err != nil {
+		return err
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := validateClusters(cfg.Clusters); err != nil {
+		return err
+	}
+	if err := validateConflictPolicy(cfg.ConflictPolicy); err != nil {
+		return err
+	}
+	if err := validateMetadata(cfg.Labels, cfg.Annotations); err != nil {
+		return err
+	}
+	if err := validateCompression(cfg.Compression); err != nil {
+		return err
+	}
+	if err := validateEncryption(cfg.Encryption); err != nil {
+		return err
+	}
+	if err := validateHostSources(cfg.AllowedHostSources); err != nil {
+		return err
+	}
+	if err := validateTokenExpiration(cfg.TokenExpiration); err != nil {
+		return err
+	}
+	if err := validateTokenServiceAccounts(cfg.TokenServiceAccounts); err != nil {
+		return err
+	}
+	if err := validateNamespacePolicy(cfg.Policy); err != nil {
+		return err
+	}
+	if err := validateExposeLabel(cfg.ExposeLabel); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateMetadata(labels map[string]string, annotations map[string]string) error {
+	for k, v := range labels {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid label %q: %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid value for label %q: %s", k, strings.Join(errs, ", "))
+		}
+	}
+	for k := range annotations {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid annotation %q: %s", k, strings.Join(errs, ", "))
+		}
+	}
+	return nil
 }
@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"testing"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/config"
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"get.porter.sh/porter/pkg/portercontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginConfig_Validate(t *testing.T) {
+	valid := PluginConfig{
+		Clusters:             map[string]ClusterProfile{"workload-a": {Namespace: "apps"}},
+		ConflictPolicy:       ConflictPolicyReplace,
+		Labels:               map[string]string{"example.com/team": "platform"},
+		Annotations:          map[string]string{"owner": "any value is allowed"},
+		Compression:          CompressionZstd,
+		AllowedHostSources:   []string{"env", "path", "command"},
+		TokenExpiration:      "30m",
+		TokenServiceAccounts: []string{"ci/*"},
+		ExposeLabel:          "example.com/porter=yes",
+		PrefetchSelector:     "porter.sh/expose=true,team in (a,b)",
+		Policy:               NamespacePolicy{AllowedNamespaces: []string{"tenant-a-*"}, DeniedNamespaces: []string{"kube-system"}},
+		Encryption:           EncryptionConfig{KeySecret: "porter/keys#keyring"},
+	}
+	require.NoError(t, valid.Validate())
+	require.NoError(t, PluginConfig{}.Validate())
+
+	tests := []struct {
+		desc    string
+		cfg     PluginConfig
+		wantErr string
+	}{
+		{"compression", PluginConfig{Compression: "brotli"}, `invalid compression "brotli"`},
+		{"token expiration", PluginConfig{TokenExpiration: "1m"}, `invalid token expiration "1m"`},
+		{"token service accounts", PluginConfig{TokenServiceAccounts: []string{"deployer"}}, `invalid tokenServiceAccounts pattern "deployer", expected NAMESPACE/NAME`},
+		{"expose label", PluginConfig{ExposeLabel: "porter expose"}, `invalid exposeLabel "porter expose"`},
+		{"retry", PluginConfig{Retry: k8shelper.RetryConfig{MaxAttempts: -1}}, "invalid retry maxAttempts -1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			require.ErrorContains(t, tt.cfg.Validate(), tt.wantErr)
+		})
+	}
+}
+
+func TestNewPluginConfig_PreviousEncryption(t *testing.T) {
+	tc := portercontext.NewTestContext(t)
+	cfg, err := NewPluginConfig(tc.Context, config.Config{Encryption: config.EncryptionConfig{
+		KMSEndpoint: "unix:///kms.sock",
+		Previous:    &config.EncryptionConfig{KeyFile: "keyring"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, EncryptionConfig{KMSEndpoint: "unix:///kms.sock", Previous: &EncryptionConfig{KeyFile: "keyring"}}, cfg.Encryption)
+}
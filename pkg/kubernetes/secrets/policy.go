@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"fmt"
+	"path"
+)
+
+// NamespacePolicy restricts the namespaces that the plugin may read from and
+// write to, regardless of the RBAC permissions of its user or service
+// account. Patterns use the syntax of path.Match, such as tenant-a-*.
+type NamespacePolicy struct {
+	// AllowedNamespaces are the namespaces that may be used. When empty,
+	// every namespace that is not denied may be used.
+	AllowedNamespaces []string `mapstructure:"allowedNamespaces"`
+
+	// DeniedNamespaces are the namespaces that may never be used, even when
+	// they are allowed.
+	DeniedNamespaces []string `mapstructure:"deniedNamespaces"`
+}
+
+func validateNamespacePolicy(policy NamespacePolicy) error {
+	for _, patterns := range [][]string{policy.AllowedNamespaces, policy.DeniedNamespaces} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid namespace pattern %q in the policy: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// allows determines if the policy allows a namespace to be used.
+func (p NamespacePolicy) allows(namespace string) bool {
+	if matchesNamespace(p.DeniedNamespaces, namespace) {
+		return false
+	}
+	return len(p.AllowedNamespaces) == 0 || matchesNamespace(p.AllowedNamespaces, namespace)
+}
+
+func matchesNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		// The patterns are checked by NewPluginConfig
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNamespace returns a NamespaceNotAllowedError, and logs the denied
+// reference, when the policy does not allow the namespace to be used. It is
+// called before the API is used with a namespace.
+func (s *Store) checkNamespace(namespace string, keyValue string) error {
+	if s.policy.allows(namespace) {
+		return nil
+	}
+	s.logger.Warn(fmt.Sprintf("Store.checkNamespace: denied access to namespace %s for reference %s", namespace, keyValue))
+	return NamespaceNotAllowedError{msg: fmt.Sprintf("the namespace %s of %s is not allowed by the policy of the kubernetes.secrets plugin. "+
+		"Check allowedNamespaces and deniedNamespaces in the plugin config", namespace, keyValue)}
+}
@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacePolicy_Allows(t *testing.T) {
+	testcases := []struct {
+		name      string
+		policy    NamespacePolicy
+		namespace string
+		want      bool
+	}{
+		{name: "no policy", namespace: "tenant-b", want: true},
+		{name: "allowed", policy: NamespacePolicy{AllowedNamespaces: []string{"tenant-a-*"}}, namespace: "tenant-a-ci", want: true},
+		{name: "not allowed", policy: NamespacePolicy{AllowedNamespaces: []string{"tenant-a-*"}}, namespace: "tenant-b", want: false},
+		{name: "denied", policy: NamespacePolicy{DeniedNamespaces: []string{"kube-*"}}, namespace: "kube-system", want: false},
+		{name: "denied overrides allowed", policy: NamespacePolicy{AllowedNamespaces: []string{"*"}, DeniedNamespaces: []string{"kube-system"}}, namespace: "kube-system", want: false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.policy.allows(tc.namespace))
+		})
+	}
+}
+
+func TestStore_NamespacePolicy(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{Policy: NamespacePolicy{AllowedNamespaces: []string{testNamespace, "tenant-a-*"}}},
+		newSecret("password", map[string]string{"value": "topsecret"}))
+	var logs bytes.Buffer
+	s.logger = hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Warn})
+
+	got, err := s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "topsecret", got)
+
+	_, err = s.Resolve(ctx, SecretSourceType, "tenant-b/password")
+	require.ErrorAs(t, err, &NamespaceNotAllowedError{})
+	require.EqualError(t, err, "the namespace tenant-b of tenant-b/password is not allowed by the policy of the kubernetes.secrets plugin. "+
+		"Check allowedNamespaces and deniedNamespaces in the plugin config")
+	require.Contains(t, logs.String(), "denied access to namespace tenant-b for reference tenant-b/password")
+
+	_, err = s.Resolve(ctx, ServiceAccountTokenSourceType, "tenant-b/deployer?audience=vault")
+	require.ErrorAs(t, err, &NamespaceNotAllowedError{})
+	require.Contains(t, logs.String(), "denied access to namespace tenant-b for reference tenant-b/deployer?audience=vault")
+
+	err = s.Create(ctx, SecretSourceType, "tenant-b/output", "value")
+	require.ErrorAs(t, err, &NamespaceNotAllowedError{})
+
+	err = s.Delete(ctx, SecretSourceType, "tenant-b/output")
+	require.ErrorAs(t, err, &NamespaceNotAllowedError{})
+
+	// The configured namespace is checked too, such as the kubeconfig's default namespace
+	s.namespace = "tenant-b"
+	_, err = s.Resolve(ctx, SecretSourceType, "password")
+	require.ErrorAs(t, err, &NamespaceNotAllowedError{})
+}
+
+func TestValidateNamespacePolicy(t *testing.T) {
+	require.NoError(t, validateNamespacePolicy(NamespacePolicy{AllowedNamespaces: []string{"tenant-a-*"}, DeniedNamespaces: []string{"kube-system"}}))
+	require.ErrorContains(t, validateNamespacePolicy(NamespacePolicy{DeniedNamespaces: []string{"tenant-["}}), `invalid namespace pattern "tenant-["`)
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// DataKeySeparator separates the secret name from the data key in a reference, e.g. NAME#KEY.
+	DataKeySeparator = "#"
+
+	// NamespaceSeparator separates the namespace from the secret name in a reference, e.g. NAMESPACE/NAME.
+	NamespaceSeparator = "/"
+
+	// RegistrySeparator separates the field from the registry host in a
+	// reference to registry credentials, e.g. NAME#FIELD@HOST.
+	RegistrySeparator = "@"
+)
+
+// SecretReference identifies a value stored in a Kubernetes secret.
+type SecretReference struct {
+	// Namespace of the secret. When empty, the configured namespace is used.
+	Namespace string
+
+	// Name of the secret, before it is sanitized.
+	Name string
+
+	// Key in the secret's data that holds the value. When empty, the
+	// configured data key and its fallbacks are used. For registry
+	// credentials, Key is the field of the registry's credentials.
+	Key string
+
+	// Registry is the host of the registry whose credentials are read from
+	// a kubernetes.io/dockerconfigjson secret.
+	Registry string
+}
+
+// ParseReference parses a reference to a secret in the form
+// [NAMESPACE/]NAME[#KEY], or to registry credentials in the form
+// [NAMESPACE/]NAME#FIELD@HOST. The reference is only split on # when the
+// part before it is a valid secret name, so that keys which contain #, such
+// as those written by earlier versions of the plugin, are used as is.
+func ParseReference(ref string) (SecretReference, error) {
+	var result SecretReference
+
+	name, key, hasKey := strings.Cut(ref, DataKeySeparator)
+	if hasKey && name != "" && !isSecretName(name) {
+		name, key, hasKey = ref, "", false
+	}
+	if field, registry, hasRegistry := strings.Cut(key, RegistrySeparator); hasKey && hasRegistry {
+		if registry == "" {
+			return SecretReference{}, fmt.Errorf("invalid secret reference %q: the registry is empty", ref)
+		}
+		if !isRegistryField(field) {
+			return SecretReference{}, fmt.Errorf("invalid secret reference %q: invalid registry field %q, allowed values are: %s",
+				ref, field, strings.Join(registryFields, ", "))
+		}
+		result.Registry = registry
+		key = field
+	}
+	if hasKey {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return SecretReference{}, fmt.Errorf("invalid secret reference %q: invalid data key %q: %s", ref, key, strings.Join(errs, ", "))
+		}
+		result.Key = key
+	}
+
+	if namespace, nameInNamespace, hasNamespace := strings.Cut(name, NamespaceSeparator); hasNamespace {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return SecretReference{}, fmt.Errorf("invalid secret reference %q: invalid namespace %q: %s", ref, namespace, strings.Join(errs, ", "))
+		}
+		result.Namespace = namespace
+		name = nameInNamespace
+	}
+
+	if name == "" {
+		return SecretReference{}, fmt.Errorf("invalid secret reference %q: the secret name is empty", ref)
+	}
+	result.Name = name
+	return result, nil
+}
+
+// isSecretName returns true when the value is a valid secret name, with an
+// optional namespace, in the form [NAMESPACE/]NAME.
+func isSecretName(value string) bool {
+	if namespace, name, hasNamespace := strings.Cut(value, NamespaceSeparator); hasNamespace {
+		if len(validation.IsDNS1123Label(namespace)) > 0 {
+			return false
+		}
+		value = name
+	}
+	return len(validation.IsDNS1123Subdomain(value)) == 0
+}
@@ -0,0 +1,44 @@
+package secrets_test
+
+import (
+	"testing"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		expected secrets.SecretReference
+		wantErr  string
+	}{
+		{"name only", "password", secrets.SecretReference{Name: "password"}, ""},
+		{"name and key", "db-creds#password", secrets.SecretReference{Name: "db-creds", Key: "password"}, ""},
+		{"dotted key", "tls#tls.crt", secrets.SecretReference{Name: "tls", Key: "tls.crt"}, ""},
+		{"namespace and name", "platform-secrets/db-creds", secrets.SecretReference{Namespace: "platform-secrets", Name: "db-creds"}, ""},
+		{"namespace, name and key", "platform-secrets/db-creds#password", secrets.SecretReference{Namespace: "platform-secrets", Name: "db-creds", Key: "password"}, ""},
+		{"invalid namespace", "Platform_Secrets/db-creds", secrets.SecretReference{}, `invalid namespace "Platform_Secrets"`},
+		{"empty name in namespace", "platform-secrets/", secrets.SecretReference{}, "the secret name is empty"},
+		{"key containing #", "Channel #1", secrets.SecretReference{Name: "Channel #1"}, ""},
+		{"key containing # after a namespace", "team/My Key#1", secrets.SecretReference{Namespace: "team", Name: "My Key#1"}, ""},
+		{"empty name", "#password", secrets.SecretReference{}, `invalid secret reference "#password": the secret name is empty`},
+		{"invalid key", "db-creds#pass word", secrets.SecretReference{}, `invalid data key "pass word"`},
+		{"registry credentials", "ci/regcred#password@ghcr.io", secrets.SecretReference{Namespace: "ci", Name: "regcred", Key: "password", Registry: "ghcr.io"}, ""},
+		{"invalid registry field", "regcred#token@ghcr.io", secrets.SecretReference{}, `invalid registry field "token", allowed values are: username, password, auth, config`},
+		{"empty registry", "regcred#password@", secrets.SecretReference{}, "the registry is empty"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			ref, err := secrets.ParseReference(tt.input)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, ref)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RegistryUsername resolves the username of a registry's credentials.
+	RegistryUsername = "username"
+
+	// RegistryPassword resolves the password of a registry's credentials.
+	RegistryPassword = "password"
+
+	// RegistryAuth resolves the decoded auth of a registry's credentials, USERNAME:PASSWORD.
+	RegistryAuth = "auth"
+
+	// RegistryConfig resolves a config.json that only holds the registry's credentials.
+	RegistryConfig = "config"
+)
+
+var registryFields = []string{RegistryUsername, RegistryPassword, RegistryAuth, RegistryConfig}
+
+func isRegistryField(field string) bool {
+	for _, f := range registryFields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerConfig is the format of the .dockerconfigjson key of a
+// kubernetes.io/dockerconfigjson secret, and of a Docker config.json.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// credentials returns the username and password, decoding auth when they
+// aren't set separately.
+func (a dockerAuth) credentials() (string, string, error) {
+	if a.Username != "" || a.Password != "" || a.Auth == "" {
+		return a.Username, a.Password, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("the auth is not valid base64: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", fmt.Errorf("the auth is not in the form USERNAME:PASSWORD")
+	}
+	return username, password, nil
+}
+
+// resolveRegistry returns a field of the credentials for a registry from a
+// kubernetes.io/dockerconfigjson secret, such as an image pull secret.
+func resolveRegistry(namespace string, secret *v1.Secret, ref SecretReference) (string, error) {
+	data, ok := secret.Data[v1.DockerConfigJsonKey]
+	if !ok {
+		return "", InvalidSecretDataKeyError{msg: fmt.Sprintf("The secret %s/%s does not have a key named %s. "+
+			"Registry credentials can only be resolved from %s secrets", namespace, secret.Name, v1.DockerConfigJsonKey, v1.SecretTypeDockerConfigJson)}
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("could not parse the %s key of secret %s/%s: %w", v1.DockerConfigJsonKey, namespace, secret.Name, err)
+	}
+
+	host, auth, ok := findRegistry(config, ref.Registry)
+	if !ok {
+		hosts := make([]string, 0, len(config.Auths))
+		for h := range config.Auths {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		return "", InvalidSecretDataKeyError{msg: fmt.Sprintf("The secret %s/%s does not have credentials for the registry %s, "+
+			"the available registries are: %s", namespace, secret.Name, ref.Registry, strings.Join(hosts, ", "))}
+	}
+
+	if ref.Key == RegistryConfig {
+		result, err := json.Marshal(dockerConfig{Auths: map[string]dockerAuth{host: auth}})
+		return string(result), err
+	}
+
+	username, password, err := auth.credentials()
+	if err != nil {
+		return "", fmt.Errorf("invalid credentials for the registry %s in secret %s/%s: %w", host, namespace, secret.Name, err)
+	}
+	switch ref.Key {
+	case RegistryUsername:
+		return username, nil
+	case RegistryPassword:
+		return password, nil
+	default:
+		return username + ":" + password, nil
+	}
+}
+
+// findRegistry returns the credentials for a registry. Hosts are compared
+// without a scheme or path, and the different names of Docker Hub match.
+func findRegistry(config dockerConfig, registry string) (string, dockerAuth, bool) {
+	if auth, ok := config.Auths[registry]; ok {
+		return registry, auth, true
+	}
+	want := normalizeRegistry(registry)
+	for host, auth := range config.Auths {
+		if normalizeRegistry(host) == want {
+			return host, auth, true
+		}
+	}
+	return "", dockerAuth{}, false
+}
+
+func normalizeRegistry(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(host), "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStore_Resolve_Registry(t *testing.T) {
+	ctx := context.Background()
+	pullSecret := newSecret("regcred", map[string]string{v1.DockerConfigJsonKey: `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("hubuser:hubpass")) + `"},
+		"ghcr.io": {"username": "porter", "password": "ghcr-token", "auth": "ignored"}
+	}}`})
+	pullSecret.Type = v1.SecretTypeDockerConfigJson
+	s := newTestStore(t, PluginConfig{}, pullSecret)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"regcred#username@ghcr.io", "porter"},
+		{"regcred#password@ghcr.io", "ghcr-token"},
+		{"regcred#auth@ghcr.io", "porter:ghcr-token"},
+		{"regcred#username@docker.io", "hubuser"},
+		{"regcred#password@https://index.docker.io/v1/", "hubpass"},
+		{"regcred#config@ghcr.io", `{"auths":{"ghcr.io":{"username":"porter","password":"ghcr-token","auth":"ignored"}}}`},
+	}
+	for _, tt := range tests {
+		got, err := s.Resolve(ctx, SecretSourceType, tt.ref)
+		require.NoError(t, err, tt.ref)
+		require.Equal(t, tt.want, got, tt.ref)
+	}
+
+	t.Run("complete config.json", func(t *testing.T) {
+		got, err := s.Resolve(ctx, SecretSourceType, "regcred")
+		require.NoError(t, err)
+		require.Equal(t, string(pullSecret.Data[v1.DockerConfigJsonKey]), got)
+	})
+
+	t.Run("missing registry", func(t *testing.T) {
+		_, err := s.Resolve(ctx, SecretSourceType, "regcred#password@quay.io")
+		require.ErrorAs(t, err, &InvalidSecretDataKeyError{})
+		require.ErrorContains(t, err, "does not have credentials for the registry quay.io, the available registries are: ghcr.io, https://index.docker.io/v1/")
+	})
+
+	t.Run("registry credentials can't be created", func(t *testing.T) {
+		err := s.Create(ctx, SecretSourceType, "regcred#password@ghcr.io", "value")
+		require.ErrorContains(t, err, "registry credentials can't be written by the plugin")
+	})
+}
@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newSecret(name string, data map[string]string) *v1.Secret {
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace}, Data: map[string][]byte{}}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
+
+func TestStore_Resolve_DataKeys(t *testing.T) {
+	ctx := context.Background()
+	objects := []runtime.Object{
+		newSecret("default", map[string]string{SecretDataKey: "from-value", CredentialDataKey: "from-credential"}),
+		newSecret("readme", map[string]string{CredentialDataKey: "from-credential"}),
+		newSecret("db", map[string]string{"password": "from-password", "token": "from-token"}),
+	}
+
+	t.Run("default keys", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, objects...)
+
+		got, err := s.Resolve(ctx, SecretSourceType, "default")
+		require.NoError(t, err)
+		require.Equal(t, "from-value", got, "the data key should be preferred over the fallbacks")
+
+		got, err = s.Resolve(ctx, SecretSourceType, "readme")
+		require.NoError(t, err)
+		require.Equal(t, "from-credential", got)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "db")
+		require.ErrorAs(t, err, &InvalidSecretDataKeyError{})
+		require.Contains(t, err.Error(), "does not have a key named value or credential")
+	})
+
+	t.Run("configured keys", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{DataKey: "token", FallbackDataKeys: []string{"password"}}, objects...)
+
+		got, err := s.Resolve(ctx, SecretSourceType, "db")
+		require.NoError(t, err)
+		require.Equal(t, "from-token", got)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "readme")
+		require.ErrorAs(t, err, &InvalidSecretDataKeyError{}, "the default fallbacks should be replaced by the configured fallbacks")
+	})
+
+	t.Run("key in reference", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{}, objects...)
+
+		got, err := s.Resolve(ctx, SecretSourceType, "db#password")
+		require.NoError(t, err)
+		require.Equal(t, "from-password", got)
+
+		_, err = s.Resolve(ctx, SecretSourceType, "default#password")
+		require.EqualError(t, err, "The secret porter/default does not have a key named password. "+
+			"The kubernetes.secrets plugin requires that the Kubernetes secret is named after the secret referenced in the "+
+			"Porter parameter or credential set, and secret value is stored in a key on the Kubernetes secret named password, "+
+			"or in the key specified with NAME#KEY")
+	})
+
+	t.Run("create and resolve with the configured key", func(t *testing.T) {
+		s := newTestStore(t, PluginConfig{DataKey: "token"})
+
+		require.NoError(t, s.Create(ctx, SecretSourceType, "output", "test"))
+		secret, err := s.clientSet.CoreV1().Secrets(testNamespace).Get(ctx, "output", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Contains(t, secret.Data, "token")
+
+		got, err := s.Resolve(ctx, SecretSourceType, "output")
+		require.NoError(t, err)
+		require.Equal(t, "test", got)
+	})
+}
+
+func TestStore_Resolve_Namespace(t *testing.T) {
+	ctx := context.Background()
+	shared := newSecret("db", map[string]string{SecretDataKey: "shared"})
+	shared.Namespace = "platform-secrets"
+	local := newSecret("db", map[string]string{SecretDataKey: "local"})
+	s := newTestStore(t, PluginConfig{}, shared, local)
+
+	got, err := s.Resolve(ctx, SecretSourceType, "db")
+	require.NoError(t, err)
+	require.Equal(t, "local", got, "unqualified names should use the configured namespace")
+
+	got, err = s.Resolve(ctx, SecretSourceType, "platform-secrets/db")
+	require.NoError(t, err)
+	require.Equal(t, "shared", got)
+
+	_, err = s.Resolve(ctx, SecretSourceType, "platform-secrets/missing")
+	require.ErrorContains(t, err, "could not get secret platform-secrets/missing in namespace platform-secrets")
+
+	_, err = s.Resolve(ctx, SecretSourceType, "platform-secrets/db#password")
+	require.ErrorContains(t, err, "The secret platform-secrets/db does not have a key named password")
+}
+
+func TestStore_Resolve_TypedSecrets(t *testing.T) {
+	ctx := context.Background()
+	tls := newSecret("ingress-tls", map[string]string{v1.TLSCertKey: "cert", v1.TLSPrivateKeyKey: "key", "notes": "renewed"})
+	tls.Type = v1.SecretTypeTLS
+	basicAuth := newSecret("registry", map[string]string{v1.BasicAuthUsernameKey: "porter", v1.BasicAuthPasswordKey: "hunter2"})
+	basicAuth.Type = v1.SecretTypeBasicAuth
+	sshAuth := newSecret("git", map[string]string{v1.SSHAuthPrivateKey: "private key"})
+	sshAuth.Type = v1.SecretTypeSSHAuth
+	s := newTestStore(t, PluginConfig{}, tls, basicAuth, sshAuth)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"ingress-tls#tls.crt", "cert"},
+		{"ingress-tls#tls.key", "key"},
+		{"registry#username", "porter"},
+		{"registry", "hunter2"},
+		{"git", "private key"},
+	}
+	for _, tt := range tests {
+		got, err := s.Resolve(ctx, SecretSourceType, tt.ref)
+		require.NoError(t, err, tt.ref)
+		require.Equal(t, tt.want, got, tt.ref)
+	}
+
+	_, err := s.Resolve(ctx, SecretSourceType, "ingress-tls")
+	require.ErrorAs(t, err, &InvalidSecretDataKeyError{})
+	require.EqualError(t, err, "The kubernetes.io/tls secret porter/ingress-tls does not have a key named value or credential. "+
+		"Reference one of its keys with ingress-tls#KEY, the available keys are: tls.crt, tls.key, notes")
+
+	_, err = s.Resolve(ctx, SecretSourceType, "ingress-tls#ca.crt")
+	require.ErrorContains(t, err, "does not have a key named ca.crt")
+}
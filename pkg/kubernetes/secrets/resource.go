@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ResourceSourceType reads a field of any namespaced Kubernetes resource,
+// such as a Service's cluster IP or a custom resource's status, with a
+// JSONPath expression. The source is read-only.
+const ResourceSourceType = "resource"
+
+// resourceReference identifies a field of a Kubernetes resource.
+type resourceReference struct {
+	Namespace string
+	Resource  schema.GroupVersionResource
+	Name      string
+	Path      string
+}
+
+// parseResourceReference parses a reference to a field of a resource in the
+// form [NAMESPACE/]RESOURCE.VERSION[.GROUP]/NAME#JSONPATH, for example
+// services.v1/web#{.spec.clusterIP}. The braces around the JSONPath
+// expression are optional.
+func parseResourceReference(ref string) (resourceReference, error) {
+	var result resourceReference
+
+	object, path, hasPath := strings.Cut(ref, DataKeySeparator)
+	if !hasPath || path == "" {
+		return resourceReference{}, fmt.Errorf("invalid resource reference %q: the JSONPath expression is empty", ref)
+	}
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	result.Path = path
+
+	parts := strings.Split(object, NamespaceSeparator)
+	switch len(parts) {
+	case 2:
+	case 3:
+		if errs := validation.IsDNS1123Label(parts[0]); len(errs) > 0 {
+			return resourceReference{}, fmt.Errorf("invalid resource reference %q: invalid namespace %q: %s", ref, parts[0], strings.Join(errs, ", "))
+		}
+		result.Namespace = parts[0]
+		parts = parts[1:]
+	default:
+		return resourceReference{}, fmt.Errorf("invalid resource reference %q: expected [NAMESPACE/]RESOURCE.VERSION[.GROUP]/NAME#JSONPATH", ref)
+	}
+
+	// Resources in the core group, such as services.v1, don't have a group
+	resource := strings.SplitN(parts[0], ".", 3)
+	if len(resource) < 2 || resource[0] == "" || resource[1] == "" {
+		return resourceReference{}, fmt.Errorf("invalid resource reference %q: invalid resource %q, expected RESOURCE.VERSION[.GROUP], such as services.v1 or deployments.v1.apps", ref, parts[0])
+	}
+	result.Resource = schema.GroupVersionResource{Resource: resource[0], Version: resource[1]}
+	if len(resource) == 3 {
+		result.Resource.Group = resource[2]
+	}
+	// Secrets are only read with the secret source, which enforces the
+	// namespace grants, the expose label and the data key checks
+	if result.Resource.Group == "" && (strings.EqualFold(result.Resource.Resource, "secrets") || strings.EqualFold(result.Resource.Resource, "secret")) {
+		return resourceReference{}, fmt.Errorf("invalid resource reference %q: secrets can't be read with the %s source, use the %s source instead", ref, ResourceSourceType, SecretSourceType)
+	}
+
+	if parts[1] == "" {
+		return resourceReference{}, fmt.Errorf("invalid resource reference %q: the resource name is empty", ref)
+	}
+	result.Name = parts[1]
+	return result, nil
+}
+
+func (s *Store) resolveResource(ctx context.Context, keyValue string) (string, error) {
+	ref, err := parseResourceReference(keyValue)
+	if err != nil {
+		return "", err
+	}
+	namespace := s.namespace
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return "", err
+	}
+	if err := s.checkGrant(ctx, namespace, resourceGrant, ref.Resource.GroupResource().String()+NamespaceSeparator+ref.Name); err != nil {
+		return "", err
+	}
+
+	jp := jsonpath.New(ResourceSourceType).AllowMissingKeys(true)
+	if err := jp.Parse(ref.Path); err != nil {
+		return "", fmt.Errorf("invalid resource reference %q: invalid JSONPath expression: %w", keyValue, err)
+	}
+
+	obj, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*unstructured.Unstructured, error) {
+		return s.dynamicClient.Resource(ref.Resource).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not get %s %s in namespace %s: %w", ref.Resource.GroupResource(), ref.Name, namespace, err)
+	}
+
+	results, err := jp.FindResults(obj.UnstructuredContent())
+	if err != nil {
+		return "", fmt.Errorf("could not evaluate %s on %s %s in namespace %s: %w", ref.Path, ref.Resource.GroupResource(), ref.Name, namespace, err)
+	}
+	var values []any
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
+	}
+	switch len(values) {
+	case 0:
+		return "", fmt.Errorf("%s did not match a value in %s %s in namespace %s", ref.Path, ref.Resource.GroupResource(), ref.Name, namespace)
+	case 1:
+	default:
+		return "", fmt.Errorf("%s matched %d values in %s %s in namespace %s, but it must match a single value", ref.Path, len(values), ref.Resource.GroupResource(), ref.Name, namespace)
+	}
+
+	// Strings are returned as is, and other values, such as numbers or
+	// objects, as JSON
+	if value, ok := values[0].(string); ok {
+		return value, nil
+	}
+	data, err := json.Marshal(values[0])
+	if err != nil {
+		return "", fmt.Errorf("could not convert the value of %s in %s %s to a string: %w", ref.Path, ref.Resource.GroupResource(), ref.Name, err)
+	}
+	return string(data), nil
+}
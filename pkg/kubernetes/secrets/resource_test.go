@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newUnstructured(apiVersion string, kind string, namespace string, name string, fields map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestStore_Resolve_Resource(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{})
+	s.dynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "Service", testNamespace, "web", map[string]any{
+			"spec": map[string]any{
+				"clusterIP": "10.96.0.10",
+				"ports": []any{
+					map[string]any{"name": "http", "port": int64(80)},
+					map[string]any{"name": "https", "port": int64(443)},
+				},
+			},
+		}),
+		newUnstructured("example.com/v1", "Database", "data", "orders", map[string]any{
+			"status": map[string]any{"endpoint": "orders.data.svc:5432"},
+		}),
+		newUnstructured("v1", "Secret", "data", "db-creds", map[string]any{
+			"data": map[string]any{"password": "c2VjcmV0"},
+		}),
+	)
+
+	testcases := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{name: "core resource", ref: "services.v1/web#{.spec.clusterIP}", want: "10.96.0.10"},
+		{name: "without braces", ref: "services.v1/web#.spec.clusterIP", want: "10.96.0.10"},
+		{name: "filter", ref: `services.v1/web#{.spec.ports[?(@.name=="https")].port}`, want: "443"},
+		{name: "object", ref: "services.v1/web#{.spec.ports[0]}", want: `{"name":"http","port":80}`},
+		{name: "custom resource in namespace", ref: "data/databases.v1.example.com/orders#{.status.endpoint}", want: "orders.data.svc:5432"},
+		{name: "no match", ref: "services.v1/web#{.spec.loadBalancerIP}",
+			wantErr: "{.spec.loadBalancerIP} did not match a value in services web in namespace porter"},
+		{name: "multiple matches", ref: "services.v1/web#{.spec.ports[*].port}",
+			wantErr: "{.spec.ports[*].port} matched 2 values in services web in namespace porter, but it must match a single value"},
+		{name: "missing resource", ref: "services.v1/api#{.spec.clusterIP}",
+			wantErr: `could not get services api in namespace porter: services "api" not found`},
+		{name: "missing path", ref: "services.v1/web", wantErr: `invalid resource reference "services.v1/web": the JSONPath expression is empty`},
+		{name: "missing version", ref: "services/web#{.spec.clusterIP}", wantErr: `invalid resource "services"`},
+		{name: "secrets", ref: "data/secrets.v1/db-creds#{.data.password}",
+			wantErr: "secrets can't be read with the resource source, use the secret source instead"},
+		{name: "secrets in another case", ref: "data/Secrets.v1/db-creds#{.data.password}",
+			wantErr: "secrets can't be read with the resource source, use the secret source instead"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.Resolve(ctx, ResourceSourceType, tc.ref)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseResourceReference(t *testing.T) {
+	ref, err := parseResourceReference("apps/deployments.v1.apps/web#{.status.readyReplicas}")
+	require.NoError(t, err)
+	require.Equal(t, resourceReference{
+		Namespace: "apps",
+		Resource:  schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Name:      "web",
+		Path:      "{.status.readyReplicas}",
+	}, ref)
+}
@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStore_RetriesThrottledCalls(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{Retry: k8shelper.RetryConfig{MaxAttempts: 3, InitialBackoff: "1ms"}},
+		newSecret("password", map[string]string{"value": "topsecret"}))
+
+	throttled := 0
+	s.clientSet.(*fake.Clientset).PrependReactor("*", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if throttled < 2 {
+			throttled++
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return false, nil, nil
+	})
+
+	got, err := s.Resolve(ctx, SecretSourceType, "password")
+	require.NoError(t, err)
+	require.Equal(t, "topsecret", got)
+
+	throttled = 0
+	require.NoError(t, s.Create(ctx, SecretSourceType, "output", "value"))
+
+	throttled = -10
+	_, err = s.Resolve(ctx, SecretSourceType, "password")
+	require.True(t, apierrors.IsTooManyRequests(err))
+	require.ErrorContains(t, err, "slow down (failed after 3 attempts)")
+}
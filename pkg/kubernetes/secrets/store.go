@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"get.porter.sh/plugin/kubernetes/pkg"
 	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
 	"get.porter.sh/porter/pkg/portercontext"
 	portersecrets "get.porter.sh/porter/pkg/secrets/plugins"
@@ -14,8 +17,12 @@ import (
 	cnabhost "github.com/cnabio/cnab-go/secrets/host"
 	"github.com/hashicorp/go-hclog"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var _ portersecrets.SecretsProtocol = &Store{}
@@ -23,36 +30,203 @@ var _ portersecrets.SecretsProtocol = &Store{}
 const (
 	SecretSourceType = "secret"
 	SecretDataKey    = "value"
+
+	// CredentialDataKey is the data key used in the README examples, and is
+	// tried by default when a secret does not have SecretDataKey.
+	CredentialDataKey = "credential"
+
+	// ManagedByLabel marks the secrets that were created by the plugin, only
+	// those secrets may be deleted by the plugin.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "porter"
+
+	// CreatedByLabel identifies the plugin that created the secret.
+	CreatedByLabel = "app.kubernetes.io/created-by"
+	CreatedByValue = "porter-kubernetes-plugin"
+
+	// VersionLabel records the version of the plugin that created the secret.
+	VersionLabel = "app.kubernetes.io/version"
+
+	// KeyAnnotation records the original key of the secret, before it was
+	// converted to a valid Kubernetes name. It is compared with the key
+	// being resolved to detect keys that map to the same name.
+	KeyAnnotation = "secrets.porter.sh/key"
 )
 
 // Store implements the backing store for secrets as kubernetes secrets.
 type Store struct {
 	*portercontext.Context
 	hostStore cnabsecrets.Store
-	Secrets   map[string]map[string]string
+	Secrets   map[string]map[string]*v1.Secret
 	namespace string
-	clientSet *kubernetes.Clientset
+	clientSet kubernetes.Interface
 	logger    hclog.Logger
+
+	// dynamicClient reads arbitrary resources for the resource source.
+	dynamicClient dynamic.Interface
+
+	// connection selects the cluster that the store connects to.
+	connection k8shelper.ConnectionConfig
+
+	// clusters are the cluster profiles that references may select, and
+	// clusterStores resolve values from them once they are used.
+	clusters      map[string]ClusterProfile
+	clusterStores map[string]*Store
+	clustersMu    sync.Mutex
+
+	// parent is the store of the default cluster, when this store resolves
+	// values from a cluster profile.
+	parent *Store
+
+	// config is the configuration that the store was created with, which
+	// the stores of the cluster profiles are created from.
+	config PluginConfig
+
+	// prefetch determines if the secrets in the namespace are listed once,
+	// by prefetchOnce, and cached in Secrets by namespace and name, which
+	// is guarded by cacheMu.
+	prefetch         bool
+	prefetchSelector string
+	prefetchOnce     sync.Once
+	cacheMu          sync.Mutex
+
+	// retrier limits and retries the API calls.
+	retrier k8shelper.Retrier
+
+	// restConfig is the configuration of the connection to the cluster,
+	// which is used to generate kubeconfig files.
+	restConfig *rest.Config
+
+	dataKey          string
+	fallbackDataKeys []string
+	conflictPolicy   string
+	immutable        bool
+	labels           map[string]string
+	annotations      map[string]string
+
+	// chunkSize is the largest value that is stored in a single secret.
+	chunkSize int
+
+	// compression is the algorithm used to compress values before they are stored.
+	compression string
+
+	// maxDecompressedSize is the largest value that a compressed value may expand to.
+	maxDecompressedSize int
+
+	// allowedHostSources are the host sources that may be resolved by hostStore.
+	allowedHostSources map[string]bool
+
+	// policy restricts the namespaces that may be used.
+	policy NamespacePolicy
+
+	// exposeKey and exposeValue are the label or annotation that a secret
+	// must have to be resolved. Every secret is resolved when exposeKey is empty.
+	exposeKey   string
+	exposeValue string
+
+	// requireGrants determines if secrets outside the configured namespace
+	// may only be read when a grant in their namespace allows it.
+	requireGrants bool
+
+	// tokenAudiences and tokenExpiration are the defaults for tokens
+	// requested by the serviceaccount-token source.
+	tokenAudiences  []string
+	tokenExpiration time.Duration
+
+	// tokenServiceAccounts are the patterns of the service accounts in other
+	// namespaces that tokens may be requested for.
+	tokenServiceAccounts []string
+
+	// encryption selects the key-encryption key, and keys is the provider
+	// of that key once it is loaded.
+	encryption EncryptionConfig
+	keys       keyProvider
+	keysMu     sync.Mutex
+
+	// previousKeys is the provider of the previous key-encryption key,
+	// which is only used to read values that were not rewrapped yet.
+	previousKeys keyProvider
+
+	// connectMu guards the lazy connection to the cluster.
+	connectMu sync.Mutex
 }
 
 func NewStore(c *portercontext.Context, cfg PluginConfig) *Store {
 	namespace := cfg.Namespace
 	s := &Store{
-		Secrets:   make(map[string]map[string]string),
-		hostStore: &cnabhost.SecretStore{},
-		namespace: namespace,
-		logger:    cfg.Logger,
+		Secrets:          make(map[string]map[string]*v1.Secret),
+		hostStore:        &cnabhost.SecretStore{},
+		namespace:        namespace,
+		connection:       cfg.ConnectionConfig,
+		clusters:         cfg.Clusters,
+		config:           cfg,
+		prefetch:         cfg.Prefetch,
+		prefetchSelector: cfg.PrefetchSelector,
+		clusterStores:    make(map[string]*Store),
+		logger:           cfg.Logger,
+		dataKey:          cfg.DataKey,
+		fallbackDataKeys: cfg.FallbackDataKeys,
+		conflictPolicy:   cfg.ConflictPolicy,
+		immutable:        true,
+		labels:           cfg.Labels,
+		annotations:      cfg.Annotations,
+		chunkSize:        v1.MaxSecretSize,
+		compression:      cfg.Compression,
+		encryption:       cfg.Encryption,
+		tokenAudiences:   cfg.TokenAudiences,
+		tokenExpiration:  DefaultTokenExpiration,
+
+		maxDecompressedSize:  MaxDecompressedSize,
+		tokenServiceAccounts: cfg.TokenServiceAccounts,
+
+		allowedHostSources: allowedHostSources(cfg.AllowedHostSources),
+		policy:             cfg.Policy,
+		requireGrants:      cfg.RequireGrants,
+	}
+	if cfg.Immutable != nil {
+		s.immutable = *cfg.Immutable
+	}
+	// The retry settings are checked by NewPluginConfig
+	s.retrier, _ = k8shelper.NewRetrier(cfg.Retry)
+	if cfg.ExposeLabel != "" {
+		// The label is checked by NewPluginConfig
+		s.exposeKey, s.exposeValue, _ = parseExposeLabel(cfg.ExposeLabel)
+	}
+	if cfg.TokenExpiration != "" {
+		// The expiration is checked by NewPluginConfig
+		if expiration, err := time.ParseDuration(cfg.TokenExpiration); err == nil {
+			s.tokenExpiration = expiration
+		}
+	}
+	if s.conflictPolicy == "" {
+		s.conflictPolicy = ConflictPolicyFail
+	}
+	if s.dataKey == "" {
+		s.dataKey = SecretDataKey
+	}
+	if s.fallbackDataKeys == nil {
+		s.fallbackDataKeys = []string{CredentialDataKey}
 	}
 	return s
 }
 
 func (s *Store) connect() error {
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
 
 	if s.clientSet != nil {
 		return nil
 	}
 	s.logger.Debug(fmt.Sprintf("Store.connect: pre-clientset %s : %s", "namespace", s.namespace))
-	clientSet, namespace, err := k8shelper.GetClientSet(s.namespace)
+	restConfig, namespace, err := k8shelper.GetRestConfig(s.namespace, s.connection)
+	if err != nil {
+		return err
+	}
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
 		return err
 	}
@@ -60,6 +234,8 @@ func (s *Store) connect() error {
 	s.logger.Debug(fmt.Sprintf("Store.connect: post-clientset %s : %s", "namespace", s.namespace))
 
 	s.clientSet = clientSet
+	s.dynamicClient = dynamicClient
+	s.restConfig = restConfig
 
 	return nil
 }
@@ -68,27 +244,130 @@ func (s *Store) Resolve(ctx context.Context, keyName string, keyValue string) (s
 	ctx, log := tracing.StartSpan(ctx)
 	defer log.EndSpan()
 
+	// Host sources don't need a connection to the cluster
+	key := strings.ToLower(keyName)
+	if !isClusterSource(key) {
+		if err := s.checkHostSource(keyName); err != nil {
+			return "", log.Error(err)
+		}
+		return s.hostStore.Resolve(keyName, keyValue)
+	}
+
+	if cluster, ref := s.splitCluster(keyValue); cluster != "" {
+		s.logger.Debug(fmt.Sprintf("Store.Resolve: cluster:%s, keyName:%s, keyValue:%s", cluster, keyName, ref))
+		return s.clusterStore(cluster).Resolve(ctx, keyName, ref)
+	}
+
 	if err := s.connect(); err != nil {
 		return "", err
 	}
-	if strings.ToLower(keyName) != SecretSourceType {
-		return s.hostStore.Resolve(keyName, keyValue)
-	}
 	s.logger.Debug(fmt.Sprintf("Store.Resolve: ns:%s, keyName:%s, keyValue:%s", s.namespace, keyName, keyValue))
-	key := SanitizeKey(keyValue)
 
-	secret, err := s.clientSet.CoreV1().Secrets(s.namespace).Get(ctx, key, metav1.GetOptions{})
+	var val string
+	var err error
+	switch key {
+	case ConfigMapSourceType:
+		val, err = s.resolveConfigMap(ctx, keyValue)
+	case ServiceAccountTokenSourceType:
+		val, err = s.resolveServiceAccountToken(ctx, keyValue)
+	case KubeconfigSourceType:
+		val, err = s.resolveKubeconfig(ctx, keyValue)
+	case ResourceSourceType:
+		val, err = s.resolveResource(ctx, keyValue)
+	default:
+		val, err = s.resolveSecret(ctx, keyValue)
+	}
+	if err != nil {
+		return "", log.Error(err)
+	}
+	return val, nil
+}
+
+// isClusterSource determines if a source type is resolved from the cluster,
+// rather than from the host running the plugin.
+func isClusterSource(key string) bool {
+	switch key {
+	case SecretSourceType, ConfigMapSourceType, ServiceAccountTokenSourceType, KubeconfigSourceType, ResourceSourceType:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Store) resolveSecret(ctx context.Context, keyValue string) (string, error) {
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return "", err
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return "", err
+	}
+	if err := s.checkGrant(ctx, namespace, secretGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return "", err
+	}
+
+	secret, err := s.getSecret(ctx, namespace, ref)
+	if err != nil {
+		return "", fmt.Errorf("could not get secret %s in namespace %s: %w ", keyValue, namespace, err)
+	}
+	if err := s.checkExposed(namespace, secret); err != nil {
+		return "", err
+	}
+
+	if ref.Registry != "" {
+		return resolveRegistry(namespace, secret, ref)
+	}
+
+	dataKeys := s.secretDataKeys(secret, ref)
+	val, ok, err := s.readValue(ctx, namespace, secret, dataKeys)
 	if err != nil {
-		return "", log.Error(fmt.Errorf("could not get secret %s: %w ", keyValue, err))
+		return "", err
+	}
+	if !ok {
+		return "", missingDataKeyError(namespace, secret, ref, dataKeys)
+	}
+	return string(val), nil
+}
+
+// readValue returns the decoded value of a secret, reassembled from its
+// chunks when the secret is a chunk index. Otherwise the data keys are
+// checked in order, and ok is false when the secret has none of them.
+func (s *Store) readValue(ctx context.Context, namespace string, secret *v1.Secret, dataKeys []string) (value []byte, ok bool, err error) {
+	if isChunkIndex(secret) {
+		value, err = s.readChunks(ctx, namespace, secret)
+		if err != nil {
+			return nil, false, err
+		}
+		value, err = s.decodeValue(ctx, namespace, secret, value)
+		return value, err == nil, err
 	}
-	if val, ok := secret.Data[SecretDataKey]; !ok {
-		return "", log.Error(InvalidSecretDataKeyError{msg: fmt.Sprintf(`The secret %s/%s does not have a key named %s. `+
-			`The kubernetes.secrets plugin requires that the Kubernetes secret is named after the secret referenced in the `+
-			`Porter parameter or credential set, and secret value is stored in a key on the Kubernetes secret named %s`,
-			s.namespace, keyValue, SecretDataKey, SecretDataKey)})
-	} else {
-		return string(val), nil
+
+	for _, dataKey := range dataKeys {
+		if value, ok := secret.Data[dataKey]; ok {
+			value, err = s.decodeValue(ctx, namespace, secret, value)
+			return value, err == nil, err
+		}
+	}
+	return nil, false, nil
+}
+
+// namespaceFor returns the namespace of the referenced secret, defaulting to
+// the configured namespace when the reference doesn't specify one.
+func (s *Store) namespaceFor(ref SecretReference) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
 	}
+	return s.namespace
+}
+
+// dataKeys returns the keys in a secret's data that are checked for the
+// referenced value, in order.
+func (s *Store) dataKeys(ref SecretReference) []string {
+	if ref.Key != "" {
+		return []string{ref.Key}
+	}
+	return append([]string{s.dataKey}, s.fallbackDataKeys...)
 }
 
 func (s *Store) Create(ctx context.Context, keyName string, keyValue string, value string) error {
@@ -100,29 +379,242 @@ func (s *Store) Create(ctx context.Context, keyName string, keyValue string, val
 	}
 
 	s.logger.Debug(fmt.Sprintf("Store.Create: ns:%s, keyName:%s, keyValue:%s", s.namespace, keyName, keyValue))
+	if err := s.checkDefaultCluster(keyValue); err != nil {
+		return log.Error(err)
+	}
 
 	key := strings.ToLower(keyName)
+	if key == ConfigMapSourceType {
+		return log.Error(s.createConfigMap(ctx, keyValue, value))
+	}
 	if key != SecretSourceType {
-		return log.Error(fmt.Errorf("unsupported secret type: %s. Only %s is supported", keyName, SecretSourceType))
+		return log.Error(fmt.Errorf("unsupported secret type: %s. Only %s and %s are supported", keyName, SecretSourceType, ConfigMapSourceType))
 	}
 
-	byteValue := []byte(value)
-	if len(byteValue) > v1.MaxSecretSize {
-		return log.Error(fmt.Errorf("secret: %s exceeded the maximum secret size", key))
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return log.Error(err)
 	}
 
-	Immutable := true
+	if ref.Registry != "" {
+		return log.Error(fmt.Errorf("invalid secret reference %q: registry credentials can't be written by the plugin", keyValue))
+	}
+
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return log.Error(err)
+	}
+	if err := s.checkGrant(ctx, namespace, secretGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return log.Error(err)
+	}
+	meta := s.objectMeta(ref)
+	byteValue, encodingAnnotations, err := s.encodeValue(ctx, meta.Name, []byte(value))
+	if err != nil {
+		return log.Error(err)
+	}
+	for k, v := range encodingAnnotations {
+		meta.Annotations[k] = v
+	}
+
+	// Values that are too large for a single secret are split across multiple secrets
+	if len(byteValue) > s.chunkSize {
+		return log.Error(s.createChunked(ctx, namespace, meta, byteValue, []byte(value)))
+	}
+
+	dataKey := ref.Key
+	if dataKey == "" {
+		dataKey = s.dataKey
+	}
+
+	Immutable := s.immutable
 	data := map[string][]byte{
-		SecretDataKey: byteValue,
+		dataKey: byteValue,
+	}
+	secret := &v1.Secret{ObjectMeta: meta, Immutable: &Immutable, Data: data}
+	stored, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.Secret, error) {
+		return s.clientSet.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) && s.conflictPolicy != ConflictPolicyFail {
+		stored, _, err = s.handleConflict(ctx, namespace, secret, dataKey, []byte(value))
+	}
+	if err != nil {
+		return log.Error(err)
+	}
+	s.cacheSecret(namespace, stored)
+	return nil
+}
+
+// objectMeta returns the name, labels and annotations for a secret created
+// by the plugin. The configured labels and annotations are included, but
+// cannot override the ones set by the plugin.
+func (s *Store) objectMeta(ref SecretReference) metav1.ObjectMeta {
+	labels := make(map[string]string, len(s.labels)+4)
+	for k, v := range s.labels {
+		labels[k] = v
+	}
+	if s.exposeKey != "" {
+		labels[s.exposeKey] = s.exposeValue
+	}
+	labels[ManagedByLabel] = ManagedByValue
+	labels[CreatedByLabel] = CreatedByValue
+	if pkg.Version != "" && len(validation.IsValidLabelValue(pkg.Version)) == 0 {
+		labels[VersionLabel] = pkg.Version
+	}
+
+	annotations := make(map[string]string, len(s.annotations)+1)
+	for k, v := range s.annotations {
+		annotations[k] = v
+	}
+	annotations[KeyAnnotation] = ref.Name
+
+	return metav1.ObjectMeta{Name: KubernetesName(ref.Name), Labels: labels, Annotations: annotations}
+}
+
+// Delete removes a secret that was created by the plugin. Secrets that were
+// not created by the plugin are left alone, and a secret that does not exist
+// is not an error so that cleanup may be safely repeated.
+//
+// Porter's secrets plugin protocol does not include delete, so this is
+// called by the plugin's "secrets delete" command.
+func (s *Store) Delete(ctx context.Context, keyName string, keyValue string) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.Delete: ns:%s, keyName:%s, keyValue:%s", s.namespace, keyName, keyValue))
+	if err := s.checkDefaultCluster(keyValue); err != nil {
+		return log.Error(err)
+	}
+
+	if strings.ToLower(keyName) != SecretSourceType {
+		return log.Error(fmt.Errorf("unsupported secret type: %s. Only %s is supported", keyName, SecretSourceType))
+	}
+
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return log.Error(err)
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return log.Error(err)
+	}
+	if err := s.checkGrant(ctx, namespace, secretGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return log.Error(err)
+	}
+	secret, err := s.getSecret(ctx, namespace, ref)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return log.Error(fmt.Errorf("could not get secret %s in namespace %s: %w", keyValue, namespace, err))
+	}
+
+	if secret.Labels[ManagedByLabel] != ManagedByValue {
+		return log.Error(UnmanagedSecretError{msg: fmt.Sprintf(`The secret %s/%s was not created by the kubernetes.secrets plugin `+
+			`and will not be deleted. Only secrets labeled %s=%s may be deleted by the plugin`,
+			namespace, secret.Name, ManagedByLabel, ManagedByValue)})
+	}
+
+	// Only delete the secret that we checked, in case it was replaced in the meantime
+	preconditions := metav1.Preconditions{UID: &secret.UID}
+	err = s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+		return s.clientSet.CoreV1().Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{Preconditions: &preconditions})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return log.Error(fmt.Errorf("could not delete secret %s in namespace %s: %w", keyValue, namespace, err))
+	}
+	s.uncacheSecret(namespace, secret.Name)
+	return log.Error(s.deleteChunks(ctx, namespace, secret, nil))
+}
+
+// Rewrap wraps the data key of an encrypted secret with the current
+// key-encryption key, so that the previous key may be retired after a key
+// rotation. Secrets that are not encrypted are left alone.
+//
+// Porter's secrets plugin protocol does not include rewrap, so this is
+// called by the plugin's "secrets rewrap" command.
+func (s *Store) Rewrap(ctx context.Context, keyName string, keyValue string) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.Rewrap: ns:%s, keyName:%s, keyValue:%s", s.namespace, keyName, keyValue))
+
+	if strings.ToLower(keyName) != SecretSourceType {
+		return log.Error(fmt.Errorf("unsupported secret type: %s. Only %s is supported", keyName, SecretSourceType))
+	}
+
+	ref, err := ParseReference(keyValue)
+	if err != nil {
+		return log.Error(err)
+	}
+	namespace := s.namespaceFor(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return log.Error(err)
+	}
+	if err := s.checkGrant(ctx, namespace, secretGrant, ref.Name, KubernetesName(ref.Name)); err != nil {
+		return log.Error(err)
+	}
+	secret, err := s.getSecret(ctx, namespace, ref)
+	if err != nil {
+		return log.Error(fmt.Errorf("could not get secret %s in namespace %s: %w", keyValue, namespace, err))
+	}
+	if !isEncrypted(secret) {
+		return nil
+	}
+	return log.Error(s.rewrap(ctx, namespace, secret))
+}
+
+// RewrapAll rewraps the data keys of every encrypted secret created by the
+// plugin in the configured namespace, and returns the number of secrets
+// that were rewrapped.
+func (s *Store) RewrapAll(ctx context.Context) (int, error) {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	if err := s.connect(); err != nil {
+		return 0, err
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.RewrapAll: ns:%s", s.namespace))
+	if err := s.checkNamespace(s.namespace, "all secrets"); err != nil {
+		return 0, log.Error(err)
+	}
+
+	list, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.SecretList, error) {
+		return s.clientSet.CoreV1().Secrets(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: ManagedByLabel + "=" + ManagedByValue})
+	})
+	if err != nil {
+		return 0, log.Error(fmt.Errorf("could not list secrets in namespace %s: %w", s.namespace, err))
+	}
+
+	count := 0
+	for i := range list.Items {
+		secret := &list.Items[i]
+		if !isEncrypted(secret) {
+			continue
+		}
+		if err := s.rewrap(ctx, s.namespace, secret); err != nil {
+			return count, log.Error(err)
+		}
+		count++
 	}
-	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: SanitizeKey(keyValue)}, Immutable: &Immutable, Data: data}
-	_, err := s.clientSet.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
-	return log.Error(err)
+	return count, nil
 }
 
 // SanitizeKey converts a string to follow below rules:
 // 1. only contains lower case alphanumeric characters, '-' or '.'
 // 2. must start and end with an alphanumeric character
+//
+// Different keys may be converted to the same name, so secrets are now
+// named with KubernetesName, and SanitizeKey is only used to find secrets
+// that were created by earlier versions of the plugin.
 func SanitizeKey(v string) string {
 	key := strings.ToLower(v)
 	// replace non-alphanumeric characters at the beginning and the end of the string
@@ -0,0 +1,185 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ServiceAccountTokenSourceType requests a short-lived token for a
+	// service account with the TokenRequest API. The token is never stored,
+	// and expires after the configured expiration.
+	ServiceAccountTokenSourceType = "serviceaccount-token"
+
+	// DefaultTokenExpiration is the lifetime of requested tokens when it is
+	// not configured.
+	DefaultTokenExpiration = time.Hour
+
+	// MinTokenExpiration is the shortest lifetime accepted by the TokenRequest API.
+	MinTokenExpiration = 10 * time.Minute
+
+	// TokenOptionsSeparator separates the service account from the token
+	// options in a reference, e.g. NAME?audience=vault&expiration=15m.
+	TokenOptionsSeparator = "?"
+)
+
+// tokenReference identifies a service account, and the options of the
+// token that is requested for it.
+type tokenReference struct {
+	Namespace  string
+	Name       string
+	Audiences  []string
+	Expiration time.Duration
+}
+
+// parseTokenReference parses a reference to a service account in the form
+// [NAMESPACE/]NAME[?audience=AUDIENCE&expiration=DURATION]. The audience
+// may be repeated.
+func parseTokenReference(ref string) (tokenReference, error) {
+	var result tokenReference
+
+	name, rawOptions, hasOptions := strings.Cut(ref, TokenOptionsSeparator)
+	if namespace, nameInNamespace, hasNamespace := strings.Cut(name, NamespaceSeparator); hasNamespace {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return tokenReference{}, fmt.Errorf("invalid service account reference %q: invalid namespace %q: %s", ref, namespace, strings.Join(errs, ", "))
+		}
+		result.Namespace = namespace
+		name = nameInNamespace
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return tokenReference{}, fmt.Errorf("invalid service account reference %q: invalid name %q: %s", ref, name, strings.Join(errs, ", "))
+	}
+	result.Name = name
+
+	if !hasOptions {
+		return result, nil
+	}
+	options, err := url.ParseQuery(rawOptions)
+	if err != nil {
+		return tokenReference{}, fmt.Errorf("invalid service account reference %q: %w", ref, err)
+	}
+	for option, values := range options {
+		switch option {
+		case "audience":
+			result.Audiences = values
+		case "expiration":
+			result.Expiration, err = parseTokenExpiration(values[len(values)-1])
+			if err != nil {
+				return tokenReference{}, fmt.Errorf("invalid service account reference %q: %w", ref, err)
+			}
+		default:
+			return tokenReference{}, fmt.Errorf("invalid service account reference %q: unsupported option %q, allowed options are: audience, expiration", ref, option)
+		}
+	}
+	return result, nil
+}
+
+func parseTokenExpiration(value string) (time.Duration, error) {
+	expiration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid token expiration %q: %w", value, err)
+	}
+	if expiration < MinTokenExpiration {
+		return 0, fmt.Errorf("invalid token expiration %q: the expiration must be at least %s", value, MinTokenExpiration)
+	}
+	return expiration, nil
+}
+
+func validateTokenExpiration(expiration string) error {
+	if expiration == "" {
+		return nil
+	}
+	_, err := parseTokenExpiration(expiration)
+	return err
+}
+
+// resolveServiceAccountToken requests a token for a service account.
+func (s *Store) resolveServiceAccountToken(ctx context.Context, keyValue string) (string, error) {
+	ref, err := parseTokenReference(keyValue)
+	if err != nil {
+		return "", err
+	}
+	return s.requestToken(ctx, keyValue, ref)
+}
+
+// requestToken requests a token for the referenced service account. The
+// audiences and expiration in the reference override the configured ones.
+// keyValue is the reference that was parsed, which is reported when it is denied.
+func (s *Store) requestToken(ctx context.Context, keyValue string, ref tokenReference) (string, error) {
+	namespace := s.tokenNamespace(ref)
+	if err := s.checkNamespace(namespace, keyValue); err != nil {
+		return "", err
+	}
+	if err := s.checkTokenServiceAccount(namespace, ref.Name); err != nil {
+		return "", err
+	}
+	if err := s.checkGrant(ctx, namespace, serviceAccountGrant, ref.Name); err != nil {
+		return "", err
+	}
+	audiences := s.tokenAudiences
+	if len(ref.Audiences) > 0 {
+		audiences = ref.Audiences
+	}
+	expiration := s.tokenExpiration
+	if ref.Expiration != 0 {
+		expiration = ref.Expiration
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.requestToken: ns:%s, name:%s, audiences:%v, expiration:%s", namespace, ref.Name, audiences, expiration))
+
+	expirationSeconds := int64(expiration.Seconds())
+	request := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{Audiences: audiences, ExpirationSeconds: &expirationSeconds},
+	}
+	result, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*authenticationv1.TokenRequest, error) {
+		return s.clientSet.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, ref.Name, request, metav1.CreateOptions{})
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not request a token for service account %s in namespace %s: %w", ref.Name, namespace, err)
+	}
+	if result.Status.Token == "" {
+		return "", fmt.Errorf("the token request for service account %s in namespace %s did not return a token", ref.Name, namespace)
+	}
+	return result.Status.Token, nil
+}
+
+// checkTokenServiceAccount returns a TokenNotAllowedError when a token is
+// requested for a service account in another namespace that is not listed
+// in TokenServiceAccounts.
+func (s *Store) checkTokenServiceAccount(namespace string, name string) error {
+	if namespace == s.namespace || matchesNamespace(s.tokenServiceAccounts, namespace+NamespaceSeparator+name) {
+		return nil
+	}
+	s.logger.Warn(fmt.Sprintf("Store.checkTokenServiceAccount: denied a token for service account %s/%s", namespace, name))
+	return TokenNotAllowedError{msg: fmt.Sprintf("the kubernetes.secrets plugin is not allowed to request a token for the service account %s/%s. "+
+		"Tokens for service accounts in other namespaces must be allowed with tokenServiceAccounts in the plugin config", namespace, name)}
+}
+
+func validateTokenServiceAccounts(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, _, ok := strings.Cut(pattern, NamespaceSeparator); !ok {
+			return fmt.Errorf("invalid tokenServiceAccounts pattern %q, expected NAMESPACE/NAME", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tokenServiceAccounts pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// tokenNamespace returns the namespace of the referenced service account.
+func (s *Store) tokenNamespace(ref tokenReference) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return s.namespace
+}
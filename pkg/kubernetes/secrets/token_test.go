@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStore_Resolve_ServiceAccountToken(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, PluginConfig{TokenAudiences: []string{"https://kubernetes.default.svc"}, TokenExpiration: "30m", TokenServiceAccounts: []string{"ci/*"}})
+
+	var requests []k8stesting.CreateActionImpl
+	s.clientSet.(*fake.Clientset).PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateActionImpl)
+		requests = append(requests, create)
+		result := create.GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+		result.Status.Token = "token-for-" + create.Name
+		return true, result, nil
+	})
+
+	got, err := s.Resolve(ctx, ServiceAccountTokenSourceType, "deployer")
+	require.NoError(t, err)
+	require.Equal(t, "token-for-deployer", got)
+
+	got, err = s.Resolve(ctx, ServiceAccountTokenSourceType, "ci/deployer?audience=vault&audience=sts&expiration=2h")
+	require.NoError(t, err)
+	require.Equal(t, "token-for-deployer", got)
+
+	_, err = s.Resolve(ctx, ServiceAccountTokenSourceType, "kube-system/deployer")
+	require.ErrorAs(t, err, &TokenNotAllowedError{}, "service accounts in other namespaces must be allowed")
+
+	require.Len(t, requests, 2)
+	require.Equal(t, testNamespace, requests[0].Namespace)
+	require.Equal(t, "token", requests[0].Subresource)
+	spec := requests[0].Object.(*authenticationv1.TokenRequest).Spec
+	require.Equal(t, []string{"https://kubernetes.default.svc"}, spec.Audiences)
+	require.Equal(t, int64(30*60), *spec.ExpirationSeconds)
+
+	require.Equal(t, "ci", requests[1].Namespace)
+	spec = requests[1].Object.(*authenticationv1.TokenRequest).Spec
+	require.Equal(t, []string{"vault", "sts"}, spec.Audiences)
+	require.Equal(t, int64(2*60*60), *spec.ExpirationSeconds)
+}
+
+func TestParseTokenReference(t *testing.T) {
+	ref, err := parseTokenReference("deployer?expiration=15m")
+	require.NoError(t, err)
+	require.Equal(t, tokenReference{Name: "deployer", Expiration: 15 * time.Minute}, ref)
+
+	_, err = parseTokenReference("deployer?expiration=1m")
+	require.EqualError(t, err, `invalid service account reference "deployer?expiration=1m": invalid token expiration "1m": the expiration must be at least 10m0s`)
+
+	_, err = parseTokenReference("deployer?scope=admin")
+	require.ErrorContains(t, err, `unsupported option "scope"`)
+
+	_, err = parseTokenReference("Deployer")
+	require.ErrorContains(t, err, `invalid name "Deployer"`)
+}
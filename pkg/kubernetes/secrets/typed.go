@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// typedSecret describes the data keys of a built-in secret type.
+type typedSecret struct {
+	// defaultKey is resolved when a reference doesn't specify a key, and the
+	// secret doesn't have the configured data keys.
+	defaultKey string
+
+	// keys are the well-known data keys of the type.
+	keys []string
+}
+
+// typedSecrets are the built-in secret types whose data can be resolved
+// without storing the value in a custom key.
+var typedSecrets = map[v1.SecretType]typedSecret{
+	v1.SecretTypeTLS: {
+		keys: []string{v1.TLSCertKey, v1.TLSPrivateKeyKey, v1.ServiceAccountRootCAKey},
+	},
+	v1.SecretTypeBasicAuth: {
+		defaultKey: v1.BasicAuthPasswordKey,
+		keys:       []string{v1.BasicAuthUsernameKey, v1.BasicAuthPasswordKey},
+	},
+	v1.SecretTypeSSHAuth: {
+		defaultKey: v1.SSHAuthPrivateKey,
+		keys:       []string{v1.SSHAuthPrivateKey},
+	},
+	v1.SecretTypeDockerConfigJson: {
+		defaultKey: v1.DockerConfigJsonKey,
+		keys:       []string{v1.DockerConfigJsonKey},
+	},
+}
+
+// secretDataKeys returns the data keys that are checked for the referenced
+// value of a secret, in order, including the default key of its type.
+func (s *Store) secretDataKeys(secret *v1.Secret, ref SecretReference) []string {
+	dataKeys := s.dataKeys(ref)
+	if typed, ok := typedSecrets[secret.Type]; ok && ref.Key == "" && typed.defaultKey != "" {
+		dataKeys = append(dataKeys, typed.defaultKey)
+	}
+	return dataKeys
+}
+
+// missingDataKeyError returns an InvalidSecretDataKeyError for a secret that
+// has none of the data keys. Typed secrets list the keys that they have, so
+// that one can be referenced with NAME#KEY.
+func missingDataKeyError(namespace string, secret *v1.Secret, ref SecretReference, dataKeys []string) error {
+	if _, ok := typedSecrets[secret.Type]; !ok {
+		return InvalidSecretDataKeyError{msg: fmt.Sprintf(`The secret %s/%s does not have a key named %s. `+
+			`The kubernetes.secrets plugin requires that the Kubernetes secret is named after the secret referenced in the `+
+			`Porter parameter or credential set, and secret value is stored in a key on the Kubernetes secret named %s, `+
+			`or in the key specified with NAME%sKEY`,
+			namespace, ref.Name, strings.Join(dataKeys, " or "), strings.Join(dataKeys, " or "), DataKeySeparator)}
+	}
+
+	return InvalidSecretDataKeyError{msg: fmt.Sprintf(`The %s secret %s/%s does not have a key named %s. `+
+		`Reference one of its keys with %s%sKEY, the available keys are: %s`,
+		secret.Type, namespace, ref.Name, strings.Join(dataKeys, " or "),
+		ref.Name, DataKeySeparator, strings.Join(availableDataKeys(secret), ", "))}
+}
+
+// availableDataKeys returns the data keys of a typed secret, with the
+// well-known keys of its type first.
+func availableDataKeys(secret *v1.Secret) []string {
+	var available, other []string
+	for _, k := range typedSecrets[secret.Type].keys {
+		if _, ok := secret.Data[k]; ok {
+			available = append(available, k)
+		}
+	}
+	for k := range secret.Data {
+		if !slices.Contains(available, k) {
+			other = append(other, k)
+		}
+	}
+	sort.Strings(other)
+	return append(available, other...)
+}
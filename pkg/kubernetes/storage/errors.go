@@ -0,0 +1,26 @@
+package storage
+
+import "fmt"
+
+// DuplicateKeyError is returned when a write would store two documents with
+// the same _id, or would violate a unique index, in a collection.
+type DuplicateKeyError struct {
+	Collection string
+	Key        string
+}
+
+func (e DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key error in collection %s: %s", e.Collection, e.Key)
+}
+
+// DocumentTooLargeError is returned when a document is too large to be
+// stored in a Kubernetes ConfigMap.
+type DocumentTooLargeError struct {
+	Collection string
+	ID         string
+	Size       int
+}
+
+func (e DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("document %s in collection %s is %d bytes, which is larger than the %d bytes that fit in a Kubernetes ConfigMap", e.ID, e.Collection, e.Size, MaxDocumentSize)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/config"
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/storage/plugins"
+	"get.porter.sh/porter/pkg/storage/pluginstore"
+	"github.com/hashicorp/go-hclog"
+	hplugin "github.com/hashicorp/go-plugin"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+const PluginKey = plugins.PluginInterface + ".kubernetes.storage"
+
+var _ plugins.StorageProtocol = &Store{}
+
+type PluginConfig struct {
+	Namespace string `mapstructure:"namespace"`
+
+	// ConnectionConfig selects the cluster and the credentials that the
+	// plugin uses. Defaults to the in-cluster service account or the kubeconfig.
+	k8shelper.ConnectionConfig `mapstructure:",squash"`
+
+	// Retry configures the timeout of each API call, and how calls that fail
+	// with a retryable error are retried.
+	Retry k8shelper.RetryConfig `mapstructure:"retry"`
+
+	Logger hclog.Logger
+}
+
+func NewPlugin(cxt *portercontext.Context, pluginConfig config.Config) (hplugin.Plugin, error) {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:       PluginKey,
+		Output:     cxt.Err,
+		Level:      hclog.Debug,
+		JSONFormat: true,
+	})
+	cfg := PluginConfig{Logger: logger, Namespace: pluginConfig.Namespace}
+	logger.Debug(fmt.Sprintf("NewPlugin.Config.Namespace: %s", cfg.Namespace))
+	if err := mapstructure.Decode(pluginConfig, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "error decoding %s plugin config from %#v", PluginKey, pluginConfig)
+	}
+	if err := cfg.ConnectionConfig.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Retry.Validate(); err != nil {
+		return nil, err
+	}
+	return pluginstore.NewPlugin(cxt, NewStore(cxt, cfg)), nil
+}
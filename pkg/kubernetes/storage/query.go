@@ -0,0 +1,850 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The functions in this file evaluate the subset of the MongoDB query language
+// that Porter sends to storage plugins: filters, sorting, projections, update
+// operators and aggregation pipelines. Documents are held as bson.M values
+// that have been passed through normalize.
+
+// normalize converts a value into the canonical types used when evaluating
+// queries: documents become bson.M, arrays become bson.A, integers become
+// int64 and times become primitive.DateTime.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.M:
+		m := make(bson.M, len(t))
+		for k, val := range t {
+			m[k] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		return normalize(bson.M(t))
+	case bson.D:
+		m := make(bson.M, len(t))
+		for _, e := range t {
+			m[e.Key] = normalize(e.Value)
+		}
+		return m
+	case bson.A:
+		a := make(bson.A, len(t))
+		for i, val := range t {
+			a[i] = normalize(val)
+		}
+		return a
+	case []interface{}:
+		return normalize(bson.A(t))
+	case []string:
+		a := make(bson.A, len(t))
+		for i, val := range t {
+			a[i] = val
+		}
+		return a
+	case bson.E:
+		return bson.M{t.Key: normalize(t.Value)}
+	case int:
+		return int64(t)
+	case int8:
+		return int64(t)
+	case int16:
+		return int64(t)
+	case int32:
+		return int64(t)
+	case uint8:
+		return int64(t)
+	case uint16:
+		return int64(t)
+	case uint32:
+		return int64(t)
+	case float32:
+		return float64(t)
+	case time.Time:
+		return primitive.NewDateTimeFromTime(t)
+	default:
+		return v
+	}
+}
+
+// toDocument converts a filter, projection or stage argument to a bson.M.
+func toDocument(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	m, ok := normalize(v).(bson.M)
+	if !ok {
+		return nil, fmt.Errorf("expected a document but got %T", v)
+	}
+	return m, nil
+}
+
+// toOrderedDocument converts a sort or projection specification to a bson.D,
+// preserving the order of the fields when the caller provided one.
+func toOrderedDocument(v interface{}) (bson.D, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		return t, nil
+	case bson.M:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := make(bson.D, 0, len(t))
+		for _, k := range keys {
+			d = append(d, bson.E{Key: k, Value: t[k]})
+		}
+		return d, nil
+	case map[string]interface{}:
+		return toOrderedDocument(bson.M(t))
+	default:
+		return nil, fmt.Errorf("expected a document but got %T", v)
+	}
+}
+
+// lookup returns every value found at the dotted path in the document.
+// Arrays encountered along the path are traversed, matching the way MongoDB
+// resolves paths into embedded arrays.
+func lookup(v interface{}, path string) []interface{} {
+	return lookupParts(v, strings.Split(path, "."))
+}
+
+func lookupParts(v interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case bson.M:
+		child, ok := t[parts[0]]
+		if !ok {
+			return nil
+		}
+		return lookupParts(child, parts[1:])
+	case bson.A:
+		var results []interface{}
+		for _, item := range t {
+			results = append(results, lookupParts(item, parts)...)
+		}
+		return results
+	default:
+		return nil
+	}
+}
+
+// lookupFirst returns the first value at the dotted path, or nil when the
+// path does not exist in the document.
+func lookupFirst(doc bson.M, path string) interface{} {
+	values := lookup(doc, path)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// setPath sets the value at the dotted path, creating embedded documents as needed.
+func setPath(doc bson.M, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part]
+		if !ok || next == nil {
+			child := bson.M{}
+			current[part] = child
+			current = child
+			continue
+		}
+		child, ok := next.(bson.M)
+		if !ok {
+			return fmt.Errorf("cannot set %s: %s is not a document", path, part)
+		}
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+// unsetPath removes the value at the dotted path, if present.
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := current[part].(bson.M)
+		if !ok {
+			return
+		}
+		current = child
+	}
+	delete(current, parts[len(parts)-1])
+}
+
+// matches reports if the document satisfies the filter.
+func matches(doc bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", key)
+			}
+			ok, err = matchField(lookup(doc, key), condition)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, operator string, condition interface{}) (bool, error) {
+	clauses, ok := condition.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("%s requires an array of filters", operator)
+	}
+	for _, clause := range clauses {
+		subFilter, err := toDocument(clause)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s clause: %w", operator, err)
+		}
+		ok, err := matches(doc, subFilter)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !ok:
+			return false, nil
+		case operator == "$or" && ok:
+			return true, nil
+		case operator == "$nor" && ok:
+			return false, nil
+		}
+	}
+	return operator != "$or", nil
+}
+
+// isOperatorDocument reports if every key in the document is a query operator,
+// such as {"$gt": 1}, rather than a literal embedded document to compare against.
+func isOperatorDocument(m bson.M) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(values []interface{}, condition interface{}) (bool, error) {
+	ops, ok := condition.(bson.M)
+	if !ok || !isOperatorDocument(ops) {
+		return matchEqual(values, condition), nil
+	}
+
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = matchEqual(values, arg)
+		case "$ne":
+			ok = !matchEqual(values, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchCompare(values, op, arg)
+		case "$in", "$nin":
+			list, isArray := arg.(bson.A)
+			if !isArray {
+				return false, fmt.Errorf("%s requires an array", op)
+			}
+			for _, item := range list {
+				if matchEqual(values, item) {
+					ok = true
+					break
+				}
+			}
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			ok = (len(values) > 0) == truthy(arg)
+		case "$regex":
+			options, _ := ops["$options"].(string)
+			re, err := compileRegex(arg, options)
+			if err != nil {
+				return false, err
+			}
+			ok = matchRegex(values, re)
+		case "$options":
+			// Handled with $regex
+			continue
+		case "$not":
+			negated, err := matchField(values, arg)
+			if err != nil {
+				return false, err
+			}
+			ok = !negated
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// expand returns the values along with the elements of any array values, so
+// that a condition matches when either the array or one of its items matches.
+func expand(values []interface{}) []interface{} {
+	var expanded []interface{}
+	for _, v := range values {
+		expanded = append(expanded, v)
+		if a, ok := v.(bson.A); ok {
+			expanded = append(expanded, a...)
+		}
+	}
+	return expanded
+}
+
+func matchEqual(values []interface{}, target interface{}) bool {
+	if len(values) == 0 {
+		// A missing field is equal to null
+		return target == nil
+	}
+	for _, v := range expand(values) {
+		if equal(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []interface{}, op string, target interface{}) bool {
+	for _, v := range expand(values) {
+		if typeRank(v) != typeRank(target) {
+			continue
+		}
+		c := compare(v, target)
+		switch {
+		case op == "$gt" && c > 0,
+			op == "$gte" && c >= 0,
+			op == "$lt" && c < 0,
+			op == "$lte" && c <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func compileRegex(arg interface{}, options string) (*regexp.Regexp, error) {
+	var pattern string
+	switch t := arg.(type) {
+	case string:
+		pattern = t
+	case primitive.Regex:
+		pattern = t.Pattern
+		options += t.Options
+	default:
+		return nil, fmt.Errorf("$regex requires a string but got %T", arg)
+	}
+	var flags string
+	for _, o := range options {
+		if strings.ContainsRune("ims", o) {
+			flags += string(o)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+func matchRegex(values []interface{}, re *regexp.Regexp) bool {
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case int64:
+		return t != 0
+	case float64:
+		return t != 0
+	default:
+		return true
+	}
+}
+
+// typeRank orders values of different types the same way MongoDB does when
+// sorting, so that for example missing values sort before numbers.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int64, float64, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	default:
+		return 11
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch t := v.(type) {
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	default:
+		return 0
+	}
+}
+
+// compare orders two values, returning a negative number when a sorts before b,
+// zero when they are equal and a positive number otherwise.
+func compare(a, b interface{}) int {
+	a, b = normalize(a), normalize(b)
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case int64, float64:
+		af, bf := toFloat(av), toFloat(b)
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		bv := b.(primitive.DateTime)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+		return 0
+	case primitive.ObjectID:
+		return strings.Compare(av.Hex(), b.(primitive.ObjectID).Hex())
+	case bson.A:
+		bv := b.(bson.A)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := compare(av[i], bv[i]); c != 0 {
+				return c
+			}
+		}
+		return len(av) - len(bv)
+	default:
+		return strings.Compare(fmt.Sprintf("%#v", a), fmt.Sprintf("%#v", b))
+	}
+}
+
+func equal(a, b interface{}) bool {
+	return compare(a, b) == 0
+}
+
+// sortDocuments sorts the documents in place using a MongoDB sort
+// specification, where 1 is ascending and -1 is descending.
+func sortDocuments(docs []bson.M, spec bson.D) {
+	if len(spec) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, field := range spec {
+			c := compare(lookupFirst(docs[i], field.Key), lookupFirst(docs[j], field.Key))
+			if c == 0 {
+				continue
+			}
+			if toFloat(normalize(field.Value)) < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// project applies a MongoDB projection to a document. Inclusion projections
+// keep only the listed fields (plus _id unless excluded), exclusion
+// projections remove the listed fields.
+func project(doc bson.M, spec bson.D) (bson.M, error) {
+	if len(spec) == 0 {
+		return doc, nil
+	}
+
+	inclusion := false
+	includeID := true
+	for _, field := range spec {
+		if field.Key == "_id" {
+			includeID = truthy(normalize(field.Value))
+			continue
+		}
+		if truthy(normalize(field.Value)) {
+			inclusion = true
+		}
+	}
+
+	if !inclusion {
+		result := copyDocument(doc)
+		for _, field := range spec {
+			if !truthy(normalize(field.Value)) {
+				unsetPath(result, field.Key)
+			}
+		}
+		return result, nil
+	}
+
+	result := bson.M{}
+	if id, ok := doc["_id"]; ok && includeID {
+		result["_id"] = id
+	}
+	for _, field := range spec {
+		if field.Key == "_id" || !truthy(normalize(field.Value)) {
+			continue
+		}
+		values := lookup(doc, field.Key)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setPath(result, field.Key, values[0]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// copyDocument makes a deep copy of a document so that it can be modified
+// without affecting the original.
+func copyDocument(doc bson.M) bson.M {
+	return normalize(doc).(bson.M)
+}
+
+// applyUpdate applies MongoDB update operators, such as $set and $unset, to the document.
+func applyUpdate(doc bson.M, update bson.D) error {
+	for _, op := range update {
+		fields, err := toDocument(op.Value)
+		if err != nil {
+			return fmt.Errorf("invalid %s update: %w", op.Key, err)
+		}
+		for path, value := range fields {
+			if path == "_id" || strings.HasPrefix(path, "_id.") {
+				return fmt.Errorf("the _id field cannot be modified")
+			}
+			switch op.Key {
+			case "$set":
+				err = setPath(doc, path, value)
+			case "$unset":
+				unsetPath(doc, path)
+			case "$inc":
+				current := lookupFirst(doc, path)
+				if current == nil {
+					current = int64(0)
+				}
+				err = setPath(doc, path, add(current, value))
+			case "$push":
+				list, _ := lookupFirst(doc, path).(bson.A)
+				err = setPath(doc, path, append(list, value))
+			default:
+				return fmt.Errorf("unsupported update operator %s", op.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func add(a, b interface{}) interface{} {
+	ai, aIsInt := a.(int64)
+	bi, bIsInt := b.(int64)
+	if aIsInt && bIsInt {
+		return ai + bi
+	}
+	return toFloat(a) + toFloat(b)
+}
+
+// evaluate resolves an aggregation expression against a document. Strings
+// starting with $ are field paths, $$ROOT is the whole document, and
+// embedded documents are evaluated field by field.
+func evaluate(doc bson.M, expr interface{}) interface{} {
+	switch t := expr.(type) {
+	case string:
+		if t == "$$ROOT" || t == "$$CURRENT" {
+			return doc
+		}
+		if strings.HasPrefix(t, "$") {
+			return lookupFirst(doc, strings.TrimPrefix(t, "$"))
+		}
+		return t
+	case bson.M:
+		result := make(bson.M, len(t))
+		for k, v := range t {
+			result[k] = evaluate(doc, v)
+		}
+		return result
+	default:
+		return t
+	}
+}
+
+// aggregate runs an aggregation pipeline over the documents.
+func aggregate(docs []bson.M, pipeline []bson.D) ([]bson.M, error) {
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("each pipeline stage must contain exactly one operator, got %d", len(stage))
+		}
+		var err error
+		docs, err = runStage(docs, stage[0].Key, stage[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("error running %s pipeline stage: %w", stage[0].Key, err)
+		}
+	}
+	return docs, nil
+}
+
+func runStage(docs []bson.M, operator string, arg interface{}) ([]bson.M, error) {
+	switch operator {
+	case "$match":
+		filter, err := toDocument(arg)
+		if err != nil {
+			return nil, err
+		}
+		return filterDocuments(docs, filter)
+	case "$sort":
+		spec, err := toOrderedDocument(arg)
+		if err != nil {
+			return nil, err
+		}
+		sortDocuments(docs, spec)
+		return docs, nil
+	case "$skip":
+		n := int(toFloat(normalize(arg)))
+		if n >= len(docs) {
+			return nil, nil
+		}
+		return docs[n:], nil
+	case "$limit":
+		n := int(toFloat(normalize(arg)))
+		if n < len(docs) {
+			return docs[:n], nil
+		}
+		return docs, nil
+	case "$project":
+		spec, err := toOrderedDocument(arg)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]bson.M, 0, len(docs))
+		for _, doc := range docs {
+			projected, err := project(doc, spec)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, projected)
+		}
+		return results, nil
+	case "$group":
+		spec, err := toOrderedDocument(arg)
+		if err != nil {
+			return nil, err
+		}
+		return group(docs, spec)
+	case "$replaceWith", "$replaceRoot":
+		if operator == "$replaceRoot" {
+			root, err := toDocument(arg)
+			if err != nil {
+				return nil, err
+			}
+			arg = root["newRoot"]
+		}
+		arg = normalize(arg)
+		results := make([]bson.M, 0, len(docs))
+		for _, doc := range docs {
+			replacement, ok := evaluate(doc, arg).(bson.M)
+			if !ok {
+				return nil, fmt.Errorf("the replacement for %v is not a document", doc["_id"])
+			}
+			results = append(results, replacement)
+		}
+		return results, nil
+	case "$unwind":
+		path, ok := arg.(string)
+		if !ok {
+			spec, err := toDocument(arg)
+			if err != nil {
+				return nil, err
+			}
+			path, _ = spec["path"].(string)
+		}
+		path = strings.TrimPrefix(path, "$")
+		var results []bson.M
+		for _, doc := range docs {
+			list, ok := lookupFirst(doc, path).(bson.A)
+			if !ok {
+				continue
+			}
+			for _, item := range list {
+				unwound := copyDocument(doc)
+				if err := setPath(unwound, path, item); err != nil {
+					return nil, err
+				}
+				results = append(results, unwound)
+			}
+		}
+		return results, nil
+	case "$count":
+		field, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("$count requires a field name")
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.M{{field: int64(len(docs))}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported pipeline stage %s", operator)
+	}
+}
+
+func filterDocuments(docs []bson.M, filter bson.M) ([]bson.M, error) {
+	results := make([]bson.M, 0, len(docs))
+	for _, doc := range docs {
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			results = append(results, doc)
+		}
+	}
+	return results, nil
+}
+
+// group implements the $group stage, preserving the order in which each
+// group was first seen.
+func group(docs []bson.M, spec bson.D) ([]bson.M, error) {
+	var idExpr interface{}
+	var accumulators bson.D
+	for _, field := range spec {
+		if field.Key == "_id" {
+			idExpr = normalize(field.Value)
+			continue
+		}
+		accumulators = append(accumulators, field)
+	}
+
+	var order []string
+	groups := map[string]bson.M{}
+	for _, doc := range docs {
+		id := evaluate(doc, idExpr)
+		key := fmt.Sprintf("%#v", id)
+		result, ok := groups[key]
+		if !ok {
+			result = bson.M{"_id": id}
+			groups[key] = result
+			order = append(order, key)
+		}
+
+		for _, acc := range accumulators {
+			accSpec, err := toDocument(acc.Value)
+			if err != nil || len(accSpec) != 1 {
+				return nil, fmt.Errorf("invalid accumulator for field %s", acc.Key)
+			}
+			for op, expr := range accSpec {
+				value := evaluate(doc, expr)
+				current, seen := result[acc.Key]
+				switch op {
+				case "$first":
+					if !seen {
+						result[acc.Key] = value
+					}
+				case "$last":
+					result[acc.Key] = value
+				case "$sum":
+					if !seen {
+						current = int64(0)
+					}
+					if typeRank(value) == typeRank(int64(0)) {
+						result[acc.Key] = add(current, value)
+					} else {
+						result[acc.Key] = current
+					}
+				case "$count":
+					if !seen {
+						current = int64(0)
+					}
+					result[acc.Key] = add(current, int64(1))
+				case "$min":
+					if !seen || compare(value, current) < 0 {
+						result[acc.Key] = value
+					}
+				case "$max":
+					if !seen || compare(value, current) > 0 {
+						result[acc.Key] = value
+					}
+				case "$push":
+					list, _ := current.(bson.A)
+					result[acc.Key] = append(list, value)
+				default:
+					return nil, fmt.Errorf("unsupported accumulator %s", op)
+				}
+			}
+		}
+	}
+
+	results := make([]bson.M, 0, len(order))
+	for _, key := range order {
+		results = append(results, groups[key])
+	}
+	return results, nil
+}
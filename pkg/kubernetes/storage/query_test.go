@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatches(t *testing.T) {
+	doc := normalize(bson.M{
+		"namespace": "dev",
+		"name":      "mysql",
+		"bundle":    bson.M{"version": "1.0.0"},
+		"labels":    bson.A{"team-a", "db"},
+		"revision":  3,
+	}).(bson.M)
+
+	tests := []struct {
+		desc   string
+		filter bson.M
+		want   bool
+	}{
+		{"empty filter", bson.M{}, true},
+		{"equal", bson.M{"namespace": "dev", "name": "mysql"}, true},
+		{"not equal", bson.M{"namespace": "prod"}, false},
+		{"dotted path", bson.M{"bundle.version": "1.0.0"}, true},
+		{"array contains", bson.M{"labels": "db"}, true},
+		{"missing field is null", bson.M{"status": nil}, true},
+		{"$ne", bson.M{"namespace": bson.M{"$ne": "prod"}}, true},
+		{"$in", bson.M{"namespace": bson.M{"$in": bson.A{"prod", "dev"}}}, true},
+		{"$nin", bson.M{"namespace": bson.M{"$nin": []string{"dev"}}}, false},
+		{"$gt with mixed integer types", bson.M{"revision": bson.M{"$gt": int32(2)}}, true},
+		{"$lte", bson.M{"revision": bson.M{"$lte": 2}}, false},
+		{"$exists", bson.M{"bundle": bson.M{"$exists": true}}, true},
+		{"$exists false", bson.M{"status": bson.M{"$exists": false}}, true},
+		{"$regex", bson.M{"name": bson.M{"$regex": "^MY", "$options": "i"}}, true},
+		{"$or", bson.M{"$or": bson.A{bson.M{"name": "redis"}, bson.M{"name": "mysql"}}}, true},
+		{"$and", bson.M{"$and": bson.A{bson.M{"name": "mysql"}, bson.M{"namespace": "prod"}}}, false},
+		{"bson.D filter value", bson.M{"$or": bson.A{bson.D{{Key: "name", Value: "mysql"}}}}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := matches(doc, normalize(tt.filter).(bson.M))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatches_UnsupportedOperator(t *testing.T) {
+	_, err := matches(bson.M{"name": "mysql"}, normalize(bson.M{"name": bson.M{"$where": "true"}}).(bson.M))
+	require.EqualError(t, err, "unsupported query operator $where")
+}
+
+func TestSortDocuments(t *testing.T) {
+	docs := []bson.M{
+		{"name": "b", "rev": int64(1)},
+		{"name": "a", "rev": int64(2)},
+		{"name": "a", "rev": int64(3)},
+		{"rev": int64(4)},
+	}
+	sortDocuments(docs, bson.D{{Key: "name", Value: 1}, {Key: "rev", Value: -1}})
+
+	var revs []int64
+	for _, doc := range docs {
+		revs = append(revs, doc["rev"].(int64))
+	}
+	require.Equal(t, []int64{4, 3, 2, 1}, revs, "missing values should sort first, followed by name ascending and rev descending")
+}
+
+func TestProject(t *testing.T) {
+	doc := bson.M{"_id": "1", "name": "mysql", "bundle": bson.M{"version": "1.0.0", "digest": "sha"}}
+
+	t.Run("inclusion", func(t *testing.T) {
+		got, err := project(doc, bson.D{{Key: "bundle.version", Value: 1}})
+		require.NoError(t, err)
+		require.Equal(t, bson.M{"_id": "1", "bundle": bson.M{"version": "1.0.0"}}, got)
+	})
+
+	t.Run("exclusion", func(t *testing.T) {
+		got, err := project(doc, bson.D{{Key: "_id", Value: 0}, {Key: "bundle", Value: false}})
+		require.NoError(t, err)
+		require.Equal(t, bson.M{"name": "mysql"}, got)
+	})
+}
+
+func TestApplyUpdate(t *testing.T) {
+	doc := bson.M{"_id": "1", "status": bson.M{"state": "pending"}, "count": int64(1)}
+	err := applyUpdate(doc, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status.state", Value: "succeeded"}}},
+		{Key: "$inc", Value: bson.M{"count": 2}},
+		{Key: "$unset", Value: bson.M{"missing": ""}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, bson.M{"_id": "1", "status": bson.M{"state": "succeeded"}, "count": int64(3)}, doc)
+
+	err = applyUpdate(doc, bson.D{{Key: "$set", Value: bson.M{"_id": "2"}}})
+	require.EqualError(t, err, "the _id field cannot be modified")
+}
+
+func TestAggregate_LastOutputs(t *testing.T) {
+	// This is the pipeline Porter uses to find the most recent value of each output
+	docs := []bson.M{
+		{"name": "connstr", "resultId": "01", "value": "old"},
+		{"name": "connstr", "resultId": "02", "value": "new"},
+		{"name": "password", "resultId": "01", "value": "secret"},
+		{"name": "other", "resultId": "03", "value": "ignored", "installation": "other"},
+	}
+	for _, doc := range docs[:3] {
+		doc["installation"] = "mysql"
+	}
+
+	results, err := aggregate(docs, []bson.D{
+		{{Key: "$match", Value: bson.M{"installation": "mysql"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}, {Key: "resultId", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$name"},
+			{Key: "lastOutput", Value: bson.M{"$first": "$$ROOT"}},
+		}}},
+		{{Key: "$replaceWith", Value: "$lastOutput"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "new", results[0]["value"])
+	require.Equal(t, "secret", results[1]["value"])
+}
+
+func TestAggregate_GroupAccumulators(t *testing.T) {
+	docs := []bson.M{
+		{"ns": "a", "size": int64(1)},
+		{"ns": "a", "size": int64(5)},
+		{"ns": "b", "size": int64(2)},
+	}
+	results, err := aggregate(docs, []bson.D{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$ns"},
+			{Key: "total", Value: bson.M{"$sum": "$size"}},
+			{Key: "largest", Value: bson.M{"$max": "$size"}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: -1}}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []bson.M{
+		{"_id": "b", "total": int64(2), "largest": int64(2), "count": int64(1)},
+		{"_id": "a", "total": int64(6), "largest": int64(5), "count": int64(2)},
+	}, results)
+}
@@ -0,0 +1,696 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/storage/plugins"
+	"get.porter.sh/porter/pkg/tracing"
+	"github.com/hashicorp/go-hclog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ManagedByLabel identifies the ConfigMaps that hold Porter documents.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "porter"
+
+	// CollectionLabel records which collection a document belongs to.
+	CollectionLabel = "storage.porter.sh/collection"
+
+	// CollectionAnnotation records the full name of the collection, which may
+	// have been shortened or sanitized to fit in the collection label.
+	CollectionAnnotation = "storage.porter.sh/collection"
+
+	// IndexLabel identifies the ConfigMaps that reserve the values of a
+	// unique index for a document, and records their collection.
+	IndexLabel = "storage.porter.sh/index"
+
+	// DocumentIDAnnotation records the _id of the stored document.
+	DocumentIDAnnotation = "storage.porter.sh/id"
+
+	// DocumentDataKey is the ConfigMap data key holding the document as canonical extended JSON.
+	DocumentDataKey = "document"
+
+	// IndexKeyDataKey is the ConfigMap data key holding the values reserved by a unique index.
+	IndexKeyDataKey = "key"
+
+	// MaxDocumentSize is the largest document, in bytes of extended JSON, that
+	// can be stored. Kubernetes limits a ConfigMap to 1 MiB including its
+	// metadata, so some room is left for the labels and annotations.
+	MaxDocumentSize = 1024*1024 - 16*1024
+)
+
+// Store implements Porter's storage plugin protocol on top of Kubernetes
+// ConfigMaps. Each document is stored in its own ConfigMap, labeled with
+// its collection, and queries are evaluated in the plugin.
+type Store struct {
+	*portercontext.Context
+	namespace string
+	clientSet kubernetes.Interface
+	logger    hclog.Logger
+
+	// connection selects the cluster that the store connects to.
+	connection k8shelper.ConnectionConfig
+
+	// connectMu guards the lazy connection to the cluster.
+	connectMu sync.Mutex
+
+	// retrier limits and retries the API calls.
+	retrier k8shelper.Retrier
+
+	// indices are the unique indexes requested by Porter with EnsureIndex, by collection.
+	indices   map[string][]plugins.Index
+	indicesMu sync.Mutex
+}
+
+// storedDocument is a document along with the ConfigMap that holds it.
+type storedDocument struct {
+	configMap *v1.ConfigMap
+	doc       bson.M
+}
+
+func NewStore(c *portercontext.Context, cfg PluginConfig) *Store {
+	s := &Store{
+		Context:    c,
+		namespace:  cfg.Namespace,
+		connection: cfg.ConnectionConfig,
+		logger:     cfg.Logger,
+		indices:    make(map[string][]plugins.Index),
+	}
+	// The retry settings are checked by NewPlugin
+	s.retrier, _ = k8shelper.NewRetrier(cfg.Retry)
+	return s
+}
+
+func (s *Store) connect() error {
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
+
+	if s.clientSet != nil {
+		return nil
+	}
+	s.logger.Debug(fmt.Sprintf("Store.connect: pre-clientset %s : %s", "namespace", s.namespace))
+	clientSet, namespace, err := k8shelper.GetClientSet(s.namespace, s.connection)
+	if err != nil {
+		return err
+	}
+	s.namespace = *namespace
+	s.logger.Debug(fmt.Sprintf("Store.connect: post-clientset %s : %s", "namespace", s.namespace))
+
+	s.clientSet = clientSet
+
+	return nil
+}
+
+// EnsureIndex records the unique indexes for each collection so that they
+// are enforced on writes. Non-unique indexes are not needed because every
+// query is evaluated against the full collection.
+func (s *Store) EnsureIndex(ctx context.Context, opts plugins.EnsureIndexOptions) error {
+	_, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	s.indicesMu.Lock()
+	defer s.indicesMu.Unlock()
+	for _, index := range opts.Indices {
+		if !index.Unique {
+			continue
+		}
+		s.indices[index.Collection] = append(s.indices[index.Collection], index)
+	}
+	return nil
+}
+
+func (s *Store) Aggregate(ctx context.Context, opts plugins.AggregateOptions) ([]bson.Raw, error) {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.listDocuments(ctx, opts.Collection)
+	if err != nil {
+		return nil, log.Error(err)
+	}
+
+	results, err := aggregate(documentsOf(docs), opts.Pipeline)
+	if err != nil {
+		return nil, log.Error(fmt.Errorf("error aggregating collection %s: %w", opts.Collection, err))
+	}
+	raws, err := marshalDocuments(results)
+	return raws, log.Error(err)
+}
+
+func (s *Store) Count(ctx context.Context, opts plugins.CountOptions) (int64, error) {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.findDocuments(ctx, opts.Collection, opts.Filter)
+	if err != nil {
+		return 0, log.Error(err)
+	}
+	return int64(len(docs)), nil
+}
+
+func (s *Store) Find(ctx context.Context, opts plugins.FindOptions) ([]bson.Raw, error) {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.findDocuments(ctx, opts.Collection, opts.Filter)
+	if err != nil {
+		return nil, log.Error(err)
+	}
+
+	results := documentsOf(docs)
+	sortDocuments(results, opts.Sort)
+	if opts.Skip > 0 {
+		if opts.Skip >= int64(len(results)) {
+			results = nil
+		} else {
+			results = results[opts.Skip:]
+		}
+	}
+	if opts.Limit > 0 && opts.Limit < int64(len(results)) {
+		results = results[:opts.Limit]
+	}
+
+	for i, doc := range results {
+		results[i], err = project(doc, opts.Select)
+		if err != nil {
+			return nil, log.Error(fmt.Errorf("invalid projection: %w", err))
+		}
+	}
+
+	raws, err := marshalDocuments(results)
+	return raws, log.Error(err)
+}
+
+func (s *Store) Insert(ctx context.Context, opts plugins.InsertOptions) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	existing, err := s.listDocuments(ctx, opts.Collection)
+	if err != nil {
+		return log.Error(err)
+	}
+
+	for _, d := range opts.Documents {
+		doc, err := toDocument(d)
+		if err != nil {
+			return log.Error(fmt.Errorf("invalid document: %w", err))
+		}
+		if _, ok := doc["_id"]; !ok {
+			doc["_id"] = primitive.NewObjectID()
+		}
+		if err := s.checkUniqueIndices(opts.Collection, doc, existing); err != nil {
+			return log.Error(err)
+		}
+
+		cm, err := s.insertDocument(ctx, opts.Collection, doc)
+		if err != nil {
+			return log.Error(err)
+		}
+		existing = append(existing, storedDocument{configMap: cm, doc: doc})
+	}
+	return nil
+}
+
+func (s *Store) Patch(ctx context.Context, opts plugins.PatchOptions) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.listDocuments(ctx, opts.Collection)
+	if err != nil {
+		return log.Error(err)
+	}
+	match, err := firstMatch(docs, opts.QueryDocument)
+	if err != nil || match == nil {
+		return log.Error(err)
+	}
+
+	patched := copyDocument(match.doc)
+	if err := applyUpdate(patched, opts.Transformation); err != nil {
+		return log.Error(fmt.Errorf("error patching document %v in collection %s: %w", match.doc["_id"], opts.Collection, err))
+	}
+	if err := s.checkUniqueIndices(opts.Collection, patched, docs); err != nil {
+		return log.Error(err)
+	}
+	return log.Error(s.replaceDocument(ctx, opts.Collection, *match, patched))
+}
+
+func (s *Store) RemoveDocuments(ctx context.Context, opts plugins.RemoveOptions) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.findDocuments(ctx, opts.Collection, opts.Filter)
+	if err != nil {
+		return log.Error(err)
+	}
+	if !opts.All && len(docs) > 1 {
+		docs = docs[:1]
+	}
+
+	for _, d := range docs {
+		s.logger.Debug(fmt.Sprintf("Store.RemoveDocuments: ns:%s, collection:%s, configmap:%s", s.namespace, opts.Collection, d.configMap.Name))
+		err := s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+			return s.clientSet.CoreV1().ConfigMaps(s.namespace).Delete(ctx, d.configMap.Name, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return log.Error(fmt.Errorf("could not remove document %v from collection %s: %w", d.doc["_id"], opts.Collection, err))
+		}
+		s.releaseIndexKeys(ctx, opts.Collection, s.indexNames(opts.Collection, d.doc))
+	}
+	return nil
+}
+
+func (s *Store) Update(ctx context.Context, opts plugins.UpdateOptions) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	docs, err := s.listDocuments(ctx, opts.Collection)
+	if err != nil {
+		return log.Error(err)
+	}
+	match, err := firstMatch(docs, opts.Filter)
+	if err != nil {
+		return log.Error(err)
+	}
+
+	replacement, err := toDocument(opts.Document)
+	if err != nil {
+		return log.Error(fmt.Errorf("invalid document: %w", err))
+	}
+
+	if match == nil {
+		if !opts.Upsert {
+			return nil
+		}
+		// Use the _id from the filter when upserting a document that doesn't specify one
+		if _, ok := replacement["_id"]; !ok {
+			if id, ok := normalize(opts.Filter).(bson.M)["_id"]; ok && !isOperatorValue(id) {
+				replacement["_id"] = id
+			} else {
+				replacement["_id"] = primitive.NewObjectID()
+			}
+		}
+		if err := s.checkUniqueIndices(opts.Collection, replacement, docs); err != nil {
+			return log.Error(err)
+		}
+		_, err = s.insertDocument(ctx, opts.Collection, replacement)
+		return log.Error(err)
+	}
+
+	replacement["_id"] = match.doc["_id"]
+	if err := s.checkUniqueIndices(opts.Collection, replacement, docs); err != nil {
+		return log.Error(err)
+	}
+	return log.Error(s.replaceDocument(ctx, opts.Collection, *match, replacement))
+}
+
+// listDocuments returns every document in the collection, ordered by the
+// name of the ConfigMap that holds it so that results are stable. Only the
+// ConfigMaps of the collection are listed, but each query reads all of them,
+// so its cost grows with the size of the collection.
+func (s *Store) listDocuments(ctx context.Context, collection string) ([]storedDocument, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	selector := fmt.Sprintf("%s=%s,%s=%s", ManagedByLabel, ManagedByValue, CollectionLabel, collectionLabelValue(collection))
+	list, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.ConfigMapList, error) {
+		return s.clientSet.CoreV1().ConfigMaps(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list documents in collection %s in namespace %s: %w", collection, s.namespace, err)
+	}
+
+	docs := make([]storedDocument, 0, len(list.Items))
+	for i := range list.Items {
+		cm := &list.Items[i]
+		// The label value may be shared by collections whose names only differ
+		// in characters that aren't allowed in labels
+		if name, ok := cm.Annotations[CollectionAnnotation]; ok && name != collection {
+			continue
+		}
+		var doc bson.M
+		if err := bson.UnmarshalExtJSON([]byte(cm.Data[DocumentDataKey]), true, &doc); err != nil {
+			return nil, fmt.Errorf("could not read document from configmap %s/%s: %w", s.namespace, cm.Name, err)
+		}
+		docs = append(docs, storedDocument{configMap: cm, doc: normalize(doc).(bson.M)})
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].configMap.Name < docs[j].configMap.Name
+	})
+	return docs, nil
+}
+
+func (s *Store) findDocuments(ctx context.Context, collection string, filter bson.M) ([]storedDocument, error) {
+	docs, err := s.listDocuments(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	results := make([]storedDocument, 0, len(docs))
+	for _, d := range docs {
+		ok, err := matches(d.doc, query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		if ok {
+			results = append(results, d)
+		}
+	}
+	return results, nil
+}
+
+// insertDocument reserves the unique index values of a new document and then
+// stores it, releasing the reservations when the document can't be stored.
+func (s *Store) insertDocument(ctx context.Context, collection string, doc bson.M) (*v1.ConfigMap, error) {
+	reserved, err := s.reserveIndexKeys(ctx, collection, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := s.createDocument(ctx, collection, doc)
+	if err != nil {
+		s.releaseIndexKeys(ctx, collection, reserved)
+		return nil, err
+	}
+	return cm, nil
+}
+
+// replaceDocument reserves the unique index values that changed in a
+// document, stores it, and then releases the values that it no longer uses.
+func (s *Store) replaceDocument(ctx context.Context, collection string, existing storedDocument, doc bson.M) error {
+	reserved, err := s.reserveIndexKeys(ctx, collection, doc, existing.doc)
+	if err != nil {
+		return err
+	}
+	if err := s.updateDocument(ctx, collection, existing.configMap, doc); err != nil {
+		s.releaseIndexKeys(ctx, collection, reserved)
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, name := range s.indexNames(collection, doc) {
+		current[name] = true
+	}
+	var stale []string
+	for _, name := range s.indexNames(collection, existing.doc) {
+		if !current[name] {
+			stale = append(stale, name)
+		}
+	}
+	s.releaseIndexKeys(ctx, collection, stale)
+	return nil
+}
+
+func (s *Store) createDocument(ctx context.Context, collection string, doc bson.M) (*v1.ConfigMap, error) {
+	data, err := marshalDocument(collection, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	id := idString(doc["_id"])
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: DocumentName(collection, id),
+			Labels: map[string]string{
+				ManagedByLabel:  ManagedByValue,
+				CollectionLabel: collectionLabelValue(collection),
+			},
+			Annotations: map[string]string{
+				CollectionAnnotation: collection,
+				DocumentIDAnnotation: id,
+			},
+		},
+		Data: map[string]string{
+			DocumentDataKey: string(data),
+		},
+	}
+
+	s.logger.Debug(fmt.Sprintf("Store.createDocument: ns:%s, collection:%s, configmap:%s", s.namespace, collection, cm.Name))
+	created, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+	})
+	if apierrors.IsAlreadyExists(err) {
+		return nil, DuplicateKeyError{Collection: collection, Key: fmt.Sprintf("_id: %s", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not insert document %s into collection %s: %w", id, collection, err)
+	}
+	return created, nil
+}
+
+func (s *Store) updateDocument(ctx context.Context, collection string, cm *v1.ConfigMap, doc bson.M) error {
+	data, err := marshalDocument(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	// The resource version on the ConfigMap that we read protects against concurrent writes
+	updated := cm.DeepCopy()
+	updated.Data = map[string]string{DocumentDataKey: string(data)}
+
+	s.logger.Debug(fmt.Sprintf("Store.updateDocument: ns:%s, collection:%s, configmap:%s", s.namespace, collection, cm.Name))
+	_, err = k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(s.namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("could not update document %v in collection %s: %w", doc["_id"], collection, err)
+	}
+	return nil
+}
+
+// checkUniqueIndices returns a DuplicateKeyError when another document in the
+// collection has the same values for the fields of a unique index.
+func (s *Store) checkUniqueIndices(collection string, doc bson.M, existing []storedDocument) error {
+	for _, index := range s.uniqueIndices(collection) {
+		key := indexKey(doc, index.Keys)
+		for _, other := range existing {
+			if equal(other.doc["_id"], doc["_id"]) {
+				continue
+			}
+			if indexKey(other.doc, index.Keys) == key {
+				return DuplicateKeyError{Collection: collection, Key: key}
+			}
+		}
+	}
+	return nil
+}
+
+// reserveIndexKeys creates a ConfigMap for the values of each unique index of
+// the document, named after the collection and those values. When another
+// document holds the values, even one written concurrently by another
+// process, the Create fails with AlreadyExists and a DuplicateKeyError is
+// returned. Values that are unchanged from the previous version of the
+// document are already reserved. The names of the ConfigMaps that were
+// created are returned so that they can be released if the write fails.
+func (s *Store) reserveIndexKeys(ctx context.Context, collection string, doc bson.M, previous bson.M) ([]string, error) {
+	id := idString(doc["_id"])
+	var reserved []string
+	for _, index := range s.uniqueIndices(collection) {
+		key := indexKey(doc, index.Keys)
+		if previous != nil && indexKey(previous, index.Keys) == key {
+			continue
+		}
+
+		cm := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: IndexName(collection, key),
+				Labels: map[string]string{
+					ManagedByLabel: ManagedByValue,
+					IndexLabel:     collectionLabelValue(collection),
+				},
+				Annotations: map[string]string{
+					CollectionAnnotation: collection,
+					DocumentIDAnnotation: id,
+				},
+			},
+			Data: map[string]string{
+				IndexKeyDataKey: key,
+			},
+		}
+
+		s.logger.Debug(fmt.Sprintf("Store.reserveIndexKeys: ns:%s, collection:%s, configmap:%s", s.namespace, collection, cm.Name))
+		_, err := k8shelper.Call(ctx, s.retrier, k8shelper.NotIdempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+			return s.clientSet.CoreV1().ConfigMaps(s.namespace).Create(ctx, cm, metav1.CreateOptions{})
+		})
+		if apierrors.IsAlreadyExists(err) {
+			err = s.checkIndexOwner(ctx, collection, cm.Name, id, key)
+		} else if err == nil {
+			reserved = append(reserved, cm.Name)
+		} else {
+			err = fmt.Errorf("could not reserve unique index %s in collection %s: %w", key, collection, err)
+		}
+		if err != nil {
+			s.releaseIndexKeys(ctx, collection, reserved)
+			return nil, err
+		}
+	}
+	return reserved, nil
+}
+
+// checkIndexOwner returns a DuplicateKeyError unless the existing reservation
+// of the unique index values belongs to the document.
+func (s *Store) checkIndexOwner(ctx context.Context, collection string, name string, id string, key string) error {
+	cm, err := k8shelper.Call(ctx, s.retrier, k8shelper.Idempotent, func(ctx context.Context) (*v1.ConfigMap, error) {
+		return s.clientSet.CoreV1().ConfigMaps(s.namespace).Get(ctx, name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return fmt.Errorf("could not read unique index %s in collection %s: %w", key, collection, err)
+	}
+	if cm.Annotations[DocumentIDAnnotation] != id {
+		return DuplicateKeyError{Collection: collection, Key: key}
+	}
+	return nil
+}
+
+// releaseIndexKeys removes the ConfigMaps that reserve unique index values.
+// Failures are logged and ignored, a leftover reservation only prevents the
+// same values from being reused.
+func (s *Store) releaseIndexKeys(ctx context.Context, collection string, names []string) {
+	for _, name := range names {
+		err := s.retrier.Do(ctx, k8shelper.NotIdempotent, func(ctx context.Context) error {
+			return s.clientSet.CoreV1().ConfigMaps(s.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			s.logger.Warn(fmt.Sprintf("Store.releaseIndexKeys: could not remove configmap %s/%s from collection %s: %s", s.namespace, name, collection, err))
+		}
+	}
+}
+
+// indexNames returns the names of the ConfigMaps that reserve the unique index values of a document.
+func (s *Store) indexNames(collection string, doc bson.M) []string {
+	indices := s.uniqueIndices(collection)
+	names := make([]string, 0, len(indices))
+	for _, index := range indices {
+		names = append(names, IndexName(collection, indexKey(doc, index.Keys)))
+	}
+	return names
+}
+
+// uniqueIndices returns the unique indexes of a collection.
+func (s *Store) uniqueIndices(collection string) []plugins.Index {
+	s.indicesMu.Lock()
+	defer s.indicesMu.Unlock()
+	return s.indices[collection]
+}
+
+func indexKey(doc bson.M, keys bson.D) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %#v", k.Key, lookupFirst(doc, k.Key)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func firstMatch(docs []storedDocument, filter bson.M) (*storedDocument, error) {
+	query, err := toDocument(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	for i := range docs {
+		ok, err := matches(docs[i].doc, query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		if ok {
+			return &docs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func isOperatorValue(v interface{}) bool {
+	m, ok := v.(bson.M)
+	return ok && isOperatorDocument(m)
+}
+
+func documentsOf(docs []storedDocument) []bson.M {
+	results := make([]bson.M, len(docs))
+	for i, d := range docs {
+		results[i] = d.doc
+	}
+	return results
+}
+
+// marshalDocument returns the document as canonical extended JSON, or a
+// DocumentTooLargeError when it does not fit in a ConfigMap.
+func marshalDocument(collection string, doc bson.M) ([]byte, error) {
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal document %v: %w", doc["_id"], err)
+	}
+	if len(data) > MaxDocumentSize {
+		return nil, DocumentTooLargeError{Collection: collection, ID: idString(doc["_id"]), Size: len(data)}
+	}
+	return data, nil
+}
+
+func marshalDocuments(docs []bson.M) ([]bson.Raw, error) {
+	results := make([]bson.Raw, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal document %v: %w", doc["_id"], err)
+		}
+		results = append(results, raw)
+	}
+	return results, nil
+}
+
+func idString(id interface{}) string {
+	switch t := id.(type) {
+	case string:
+		return t
+	case primitive.ObjectID:
+		return t.Hex()
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+var invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9-.]+`)
+
+func collectionLabelValue(collection string) string {
+	value := invalidLabelCharacters.ReplaceAllString(strings.ToLower(collection), "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-.")
+}
+
+// DocumentName returns the name of the ConfigMap that stores the document
+// with the specified _id in a collection.
+func DocumentName(collection string, id string) string {
+	return objectName(collection, "", collection+"/"+id)
+}
+
+// IndexName returns the name of the ConfigMap that reserves the values of a
+// unique index in a collection.
+func IndexName(collection string, key string) string {
+	return objectName(collection, "index-", collection+"/index/"+key)
+}
+
+func objectName(collection string, kind string, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	prefix := collectionLabelValue(collection)
+	if len(prefix) > 40 {
+		prefix = strings.Trim(prefix[:40], "-.")
+	}
+	return fmt.Sprintf("porter-%s-%s%s", prefix, kind, hex.EncodeToString(sum[:])[:20])
+}
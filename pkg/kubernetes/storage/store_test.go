@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	k8shelper "get.porter.sh/plugin/kubernetes/pkg/kubernetes/helper"
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/storage/plugins"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	logger := hclog.New(&hclog.LoggerOptions{
+		Name:   PluginKey,
+		Output: os.Stderr,
+		Level:  hclog.Error,
+	})
+	tc := portercontext.NewTestContext(t)
+	s := NewStore(tc.Context, PluginConfig{Namespace: "porter", Logger: logger})
+	s.clientSet = fake.NewSimpleClientset()
+	return s
+}
+
+func decode(t *testing.T, raws []bson.Raw) []bson.M {
+	docs := make([]bson.M, len(raws))
+	for i, raw := range raws {
+		require.NoError(t, bson.Unmarshal(raw, &docs[i]))
+	}
+	return docs
+}
+
+func TestStore_InsertFind(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	err := s.Insert(ctx, plugins.InsertOptions{
+		Collection: "installations",
+		Documents: []bson.M{
+			{"_id": "1", "namespace": "dev", "name": "mysql"},
+			{"_id": "2", "namespace": "dev", "name": "redis"},
+			{"_id": "3", "namespace": "prod", "name": "mysql"},
+		},
+	})
+	require.NoError(t, err)
+
+	results, err := s.Find(ctx, plugins.FindOptions{
+		Collection: "installations",
+		Filter:     bson.M{"namespace": "dev"},
+		Sort:       bson.D{{Key: "name", Value: -1}},
+		Select:     bson.D{{Key: "name", Value: 1}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []bson.M{{"_id": "2", "name": "redis"}, {"_id": "1", "name": "mysql"}}, decode(t, results))
+
+	results, err = s.Find(ctx, plugins.FindOptions{
+		Collection: "installations",
+		Sort:       bson.D{{Key: "_id", Value: 1}},
+		Skip:       1,
+		Limit:      1,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "2", decode(t, results)[0]["_id"])
+
+	count, err := s.Count(ctx, plugins.CountOptions{Collection: "installations", Filter: bson.M{"name": "mysql"}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	count, err = s.Count(ctx, plugins.CountOptions{Collection: "runs"})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count, "collections should not share documents")
+
+	found, err := s.Find(ctx, plugins.FindOptions{Collection: "installations", Filter: bson.M{"name": "missing"}})
+	require.NoError(t, err)
+	require.Empty(t, found)
+}
+
+func TestStore_UniqueIndex(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	err := s.EnsureIndex(ctx, plugins.EnsureIndexOptions{Indices: []plugins.Index{
+		{Collection: "installations", Keys: bson.D{{Key: "namespace", Value: 1}, {Key: "name", Value: 1}}, Unique: true},
+	}})
+	require.NoError(t, err)
+
+	err = s.Insert(ctx, plugins.InsertOptions{Collection: "installations", Documents: []bson.M{{"_id": "1", "namespace": "dev", "name": "mysql"}}})
+	require.NoError(t, err)
+
+	err = s.Insert(ctx, plugins.InsertOptions{Collection: "installations", Documents: []bson.M{{"_id": "2", "namespace": "dev", "name": "mysql"}}})
+	require.ErrorAs(t, err, &DuplicateKeyError{})
+
+	err = s.Insert(ctx, plugins.InsertOptions{Collection: "installations", Documents: []bson.M{{"_id": "1", "namespace": "prod", "name": "mysql"}}})
+	require.ErrorAs(t, err, &DuplicateKeyError{}, "inserting the same _id twice should fail")
+
+	// Another process may have listed the collection before the first insert
+	_, err = s.insertDocument(ctx, "installations", bson.M{"_id": "3", "namespace": "dev", "name": "mysql"})
+	require.ErrorAs(t, err, &DuplicateKeyError{}, "the index values should be reserved by the first document")
+
+	err = s.Patch(ctx, plugins.PatchOptions{
+		Collection:     "installations",
+		QueryDocument:  bson.M{"_id": "1"},
+		Transformation: bson.D{{Key: "$set", Value: bson.D{{Key: "namespace", Value: "test"}}}},
+	})
+	require.NoError(t, err)
+	_, err = s.insertDocument(ctx, "installations", bson.M{"_id": "3", "namespace": "dev", "name": "mysql"})
+	require.NoError(t, err, "the previous index values should be released when a document changes")
+
+	err = s.RemoveDocuments(ctx, plugins.RemoveOptions{Collection: "installations", All: true})
+	require.NoError(t, err)
+	cms, err := s.clientSet.CoreV1().ConfigMaps("porter").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cms.Items, "removing the documents should release their index values")
+}
+
+func TestStore_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 15)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			errs <- s.EnsureIndex(ctx, plugins.EnsureIndexOptions{Indices: []plugins.Index{
+				{Collection: "installations", Keys: bson.D{{Key: "name", Value: 1}}, Unique: true},
+			}})
+			errs <- s.Insert(ctx, plugins.InsertOptions{Collection: "installations", Documents: []bson.M{{"_id": id, "name": "app-" + id}}})
+			_, err := s.Find(ctx, plugins.FindOptions{Collection: "installations"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	count, err := s.Count(ctx, plugins.CountOptions{Collection: "installations"})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), count)
+}
+
+func TestStore_Limits(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	err := s.Insert(ctx, plugins.InsertOptions{Collection: "outputs", Documents: []bson.M{{"_id": "1", "value": strings.Repeat("a", MaxDocumentSize)}}})
+	require.ErrorAs(t, err, &DocumentTooLargeError{})
+
+	// Both collections have the same label value
+	err = s.Insert(ctx, plugins.InsertOptions{Collection: "my_runs", Documents: []bson.M{{"_id": "1"}}})
+	require.NoError(t, err)
+	count, err := s.Count(ctx, plugins.CountOptions{Collection: "my-runs"})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
+
+func TestStore_UpdatePatchRemove(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	err := s.Update(ctx, plugins.UpdateOptions{
+		Collection: "installations",
+		Filter:     bson.M{"_id": "1"},
+		Document:   bson.M{"name": "mysql", "status": bson.M{"state": "pending"}},
+		Upsert:     true,
+	})
+	require.NoError(t, err)
+
+	err = s.Patch(ctx, plugins.PatchOptions{
+		Collection:     "installations",
+		QueryDocument:  bson.M{"_id": "1"},
+		Transformation: bson.D{{Key: "$set", Value: bson.D{{Key: "status.state", Value: "succeeded"}}}},
+	})
+	require.NoError(t, err)
+
+	results, err := s.Find(ctx, plugins.FindOptions{Collection: "installations", Filter: bson.M{"_id": "1"}})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	var doc bson.M
+	require.NoError(t, bson.Unmarshal(results[0], &doc))
+	require.Equal(t, bson.M{"_id": "1", "name": "mysql", "status": bson.M{"state": "succeeded"}}, doc)
+
+	err = s.Update(ctx, plugins.UpdateOptions{
+		Collection: "installations",
+		Filter:     bson.M{"_id": "1"},
+		Document:   bson.M{"name": "mysql"},
+	})
+	require.NoError(t, err)
+	count, err := s.Count(ctx, plugins.CountOptions{Collection: "installations", Filter: bson.M{"status": bson.M{"$exists": true}}})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count, "update should replace the entire document")
+
+	err = s.RemoveDocuments(ctx, plugins.RemoveOptions{Collection: "installations", Filter: bson.M{"_id": "1"}})
+	require.NoError(t, err)
+	count, err = s.Count(ctx, plugins.CountOptions{Collection: "installations"})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+}
+
+func TestStore_RetriesThrottledCalls(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	s.retrier, _ = k8shelper.NewRetrier(k8shelper.RetryConfig{MaxAttempts: 3, InitialBackoff: "1ms"})
+
+	throttled := 0
+	s.clientSet.(*fake.Clientset).PrependReactor("*", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if throttled < 2 {
+			throttled++
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return false, nil, nil
+	})
+
+	err := s.Insert(ctx, plugins.InsertOptions{Collection: "installations", Documents: []bson.M{{"_id": "1", "name": "mysql"}}})
+	require.NoError(t, err)
+
+	throttled = 0
+	found, err := s.Find(ctx, plugins.FindOptions{Collection: "installations"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	throttled = -10
+	_, err = s.Find(ctx, plugins.FindOptions{Collection: "installations"})
+	require.True(t, apierrors.IsTooManyRequests(err))
+	require.ErrorContains(t, err, "slow down (failed after 3 attempts)")
+}
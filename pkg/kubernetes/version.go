@@ -2,24 +2,36 @@ package kubernetes
 
 import (
 	"get.porter.sh/plugin/kubernetes/pkg"
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
 	"get.porter.sh/porter/pkg/pkgmgmt"
 	"get.porter.sh/porter/pkg/plugins"
 	"get.porter.sh/porter/pkg/porter/version"
 )
 
+// Metadata describes the plugin, including the source types that the secrets
+// implementation can resolve.
+type Metadata struct {
+	plugins.Metadata
+	SourceTypes []string `json:"sourceTypes"`
+}
+
 func (p *Plugin) PrintVersion(opts version.Options) error {
-	metadata := plugins.Metadata{
-		Metadata: pkgmgmt.Metadata{
-			Name: "kubernetes",
-			VersionInfo: pkgmgmt.VersionInfo{
-				Version: pkg.Version,
-				Commit:  pkg.Commit,
-				Author:  "Porter Authors",
+	metadata := Metadata{
+		Metadata: plugins.Metadata{
+			Metadata: pkgmgmt.Metadata{
+				Name: "kubernetes",
+				VersionInfo: pkgmgmt.VersionInfo{
+					Version: pkg.Version,
+					Commit:  pkg.Commit,
+					Author:  "Porter Authors",
+				},
+			},
+			Implementations: []plugins.Implementation{
+				{Type: "secrets", Name: "secrets"},
+				{Type: "storage", Name: "storage"},
 			},
 		},
-		Implementations: []plugins.Implementation{
-			{Type: "secrets", Name: "secrets"},
-		},
+		SourceTypes: []string{secrets.SecretSourceType, secrets.ConfigMapSourceType, secrets.ServiceAccountTokenSourceType, secrets.KubeconfigSourceType, secrets.ResourceSourceType},
 	}
 	return version.PrintVersion(p.Context, opts, metadata)
 }
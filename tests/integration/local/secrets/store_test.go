@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
@@ -111,15 +112,34 @@ func Test_IncorrectSecretDataKey(t *testing.T) {
 	t.Run("Test Incorrect Secret Data Key", func(t *testing.T) {
 		resolved, err := store.Resolve(context.Background(), secrets.SecretSourceType, "testkey")
 		require.Error(t, err)
+		dataKeys := secrets.SecretDataKey + " or " + secrets.CredentialDataKey
 		require.EqualError(t, err, fmt.Sprintf(`The secret %s/%s does not have a key named %s. `+
 			`The kubernetes.secrets plugin requires that the Kubernetes secret is named after the secret referenced in the `+
-			`Porter parameter or credential set, and secret value is stored in a key on the Kubernetes secret named %s`,
-			nsName, "testkey", secrets.SecretDataKey, secrets.SecretDataKey))
+			`Porter parameter or credential set, and secret value is stored in a key on the Kubernetes secret named %s, `+
+			`or in the key specified with NAME#KEY`,
+			nsName, "testkey", dataKeys, dataKeys))
 		require.Equal(t, resolved, "")
 	})
 
 }
 
+func Test_SecretDataKeyReference(t *testing.T) {
+	nsName := tests.CreateNamespace(t)
+	defer tests.DeleteNamespace(t, nsName)
+	k8sConfig := secrets.PluginConfig{
+		Namespace: nsName,
+		Logger:    logger,
+	}
+	tc := portercontext.NewTestContext(t)
+	store := secrets.NewStore(tc.Context, k8sConfig)
+	tests.CreateSecret(t, nsName, "password", "testkey", "testvalue")
+	t.Run("Test Secret Data Key Reference", func(t *testing.T) {
+		resolved, err := store.Resolve(context.Background(), secrets.SecretSourceType, "testkey#password")
+		require.NoError(t, err)
+		require.Equal(t, "testvalue", resolved)
+	})
+}
+
 func TestCreate_Secret(t *testing.T) {
 	nsName := tests.CreateNamespace(t)
 	k8sConfig := secrets.PluginConfig{
@@ -148,12 +168,13 @@ func TestCreate_Secret(t *testing.T) {
 		require.Equal(t, "testValue", resolved)
 	})
 
-	t.Run("exceeded maximum secret value size", func(t *testing.T) {
-		invalidValue := make([]byte, v1.MaxSecretSize+1)
-		err := store.Create(context.Background(), secrets.SecretSourceType, "testkey-max-secret-size", string(invalidValue))
-		require.Error(t, err)
+	t.Run("store a value larger than the maximum secret size in chunks", func(t *testing.T) {
+		largeValue := strings.Repeat("a", 2*v1.MaxSecretSize+1)
+		err := store.Create(context.Background(), secrets.SecretSourceType, "testkey-max-secret-size", largeValue)
+		require.NoError(t, err)
 
-		_, err = store.Resolve(context.Background(), secrets.SecretSourceType, "testkey-max-secret-size")
-		require.Error(t, err)
+		resolved, err := store.Resolve(context.Background(), secrets.SecretSourceType, "testkey-max-secret-size")
+		require.NoError(t, err)
+		require.Equal(t, largeValue, resolved)
 	})
 }
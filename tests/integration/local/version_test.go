@@ -55,7 +55,18 @@ func TestPrintJsonVersion(t *testing.T) {
     {
       "type": "secrets",
       "implementation": "secrets"
+    },
+    {
+      "type": "storage",
+      "implementation": "storage"
     }
+  ],
+  "sourceTypes": [
+    "secret",
+    "configmap",
+    "serviceaccount-token",
+    "kubeconfig",
+    "resource"
   ]
 }
 `
@@ -12,6 +12,7 @@ import (
 
 	porterv1 "get.porter.sh/operator/api/v1"
 	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/secrets"
+	"get.porter.sh/plugin/kubernetes/pkg/kubernetes/storage"
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -19,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tidwall/pretty"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -273,6 +275,96 @@ var _ = Describe("Porter k8s secrets plugin configured using a different namespa
 	})
 })
 
+var _ = Describe("Porter using the kubernetes storage plugin", func() {
+	When("applying an Installation with the storage plugin configured for the Installation namespace", func() {
+		It("successfully installs", func() {
+			By("storing the installation in configmaps")
+			randId := uuid.New()
+			installationName := fmt.Sprintf("k8s-storage-%v", randId)
+			ns := createTestNamespace(context.Background())
+			ctx := context.Background()
+			grantConfigMapAccess(ctx, ns)
+			createSecret(ns, secrets.SecretDataKey, "cred-password", "test")
+			defaultSecretsCfgName := "kubernetes-secrets"
+			porterCfg := NewPorterConfig(ns)
+			porterCfg.Spec.DefaultStorage = pointer.String("kubernetes-storage")
+			porterCfg.Spec.Storage = []porterv1.StorageConfig{
+				{
+					PluginConfig: porterv1.PluginConfig{
+						Name:         "kubernetes-storage",
+						PluginSubKey: "kubernetes.storage",
+						Config:       runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"namespace": %q}`, ns))},
+					},
+				},
+			}
+			k8sSecretsCfg := NewSecretsPluginConfig(defaultSecretsCfgName, &SecretsConfig{Namespace: ns})
+			SetPorterConfigSecrets(porterCfg, k8sSecretsCfg)
+			porterCfg.Spec.DefaultSecrets = pointer.String(defaultSecretsCfgName)
+			Expect(k8sClient.Create(context.Background(), porterCfg)).Should(Succeed())
+			credSet := NewCredSet("test", "insecureValue", "cred-password")
+			agentAction := createCredentialSetAgentAction(ns, credSet)
+			pollAA := func() bool { return agentActionPoll(agentAction) }
+			Eventually(pollAA, time.Second*120, time.Second*3).Should(BeTrue())
+			inst := NewInstallation(installationName, ns)
+			Expect(k8sClient.Create(ctx, inst)).Should(Succeed())
+
+			// Wait for the job to be created
+			installations := waitForInstallationStarted(ctx, ns, installationName)
+			installation := installations.Items[0]
+
+			// Validate that the job succeeded
+			installation = waitForInstallationFinished(ctx, installation)
+
+			// Validate that the installation status was updated
+			validateInstallStatus(inst, porterv1.PhaseSucceeded)
+			configMaps := &corev1.ConfigMapList{}
+			Expect(k8sClient.List(ctx, configMaps, client.InNamespace(ns), client.MatchingLabels{
+				storage.ManagedByLabel:  storage.ManagedByValue,
+				storage.CollectionLabel: "installations",
+			})).Should(Succeed())
+			Expect(configMaps.Items).ShouldNot(BeEmpty())
+		})
+	})
+})
+
+// grantConfigMapAccess allows the porter-agent service account to store documents in the namespace.
+func grantConfigMapAccess(ctx context.Context, ns string) {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "porter-agent-storage",
+			Namespace: ns,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"get", "list", "create", "update", "delete"},
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, role)).To(Succeed())
+
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "porter-agent-storage",
+			Namespace: ns,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      "porter-agent",
+				Namespace: ns,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     role.Name,
+		},
+	}
+	Expect(k8sClient.Create(ctx, binding)).To(Succeed())
+}
+
 func validateInstallStatus(inst *porterv1.Installation, expectedPhase porterv1.AgentPhase) {
 	ctx := context.Background()
 	instName := types.NamespacedName{Namespace: inst.Namespace, Name: inst.Name}